@@ -0,0 +1,408 @@
+package mongolang
+
+/*
+	An index advisor which looks at the queries run against a Database,
+	either as recorded by the database profiler in system.profile or as
+	captured by MonGolang itself, and proposes indexes for slow queries.
+
+		db.CaptureQueries = true
+		... run queries ...
+		db.AdviseIndexes(db.CapturedQueries).Print()
+
+	or, with the database profiler enabled:
+
+		db.AdviseIndexes(db.ProfiledQueries()).Print()
+
+	Only the most recent maxCapturedQueries queries are kept, and
+	db.CapturedQueries can be set to nil at any time to clear them.
+
+	Queries are grouped by query shape, the query with the values removed.
+	Explain is run for one query of each shape. If the winning plan includes a
+	collection scan or examines many more documents than it returns, an index is
+	proposed following the Equality, Sort, Range rule: fields tested for equality first,
+	then the sort fields, then fields tested with a range such as $gt or $lt.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// docsExaminedRatio is the ratio of documents examined to documents returned
+// above which a query is considered inefficient.
+const docsExaminedRatio = 10
+
+// maxCapturedQueries is the number of queries kept in DB.CapturedQueries.
+// Once reached, the oldest query is dropped for each new one.
+const maxCapturedQueries = 10000
+
+// CapturedQuery is a query to be analyzed by the index advisor.
+type CapturedQuery struct {
+	Coll   string
+	Filter bson.D
+	Sort   bson.D
+}
+
+// IndexAdvice is the advice for a single query shape.
+// Count is the number of queries with the shape.
+// Filter and Sort are from one of the queries with the shape.
+// If an index is recommended, CreateIndex is a ready to run
+// MonGolang call to create the index.
+type IndexAdvice struct {
+	Coll   string
+	Shape  string
+	Count  int
+	Filter bson.D
+	Sort   bson.D
+
+	Plan     ExplainSummary
+	Problems []string
+
+	Index       bson.D
+	CreateIndex string
+}
+
+// IndexAdvisorReport lists the advice for each query shape
+type IndexAdvisorReport []IndexAdvice
+
+// captureQuery records a query if query capture is enabled
+func (mg *DB) captureQuery(collName string, filter interface{}, sortSequence interface{}) {
+	if !mg.CaptureQueries || strings.HasPrefix(collName, "system.") {
+		return
+	}
+
+	query := CapturedQuery{Coll: collName}
+	query.Filter, _ = toBsonD(filter)
+	query.Sort, _ = toBsonD(sortSequence)
+
+	if len(mg.CapturedQueries) >= maxCapturedQueries {
+		n := copy(mg.CapturedQueries, mg.CapturedQueries[len(mg.CapturedQueries)-maxCapturedQueries+1:])
+		mg.CapturedQueries = mg.CapturedQueries[:n]
+	}
+	mg.CapturedQueries = append(mg.CapturedQueries, query)
+}
+
+// ProfiledQueries returns the find queries recorded by the database
+// profiler in the system.profile collection for the current Database.
+// The profiler must be enabled, for example via the MongoDB Shell
+// db.setProfilingLevel(1, { slowms: 20 }).
+func (mg *DB) ProfiledQueries() []CapturedQuery {
+	result := []CapturedQuery{}
+
+	docs := mg.Coll("system.profile").Find(`{"op":"query"}`).ToArray()
+	if mg.Err != nil {
+		return result
+	}
+
+	for _, doc := range docs {
+		ns, _ := lookup(doc, "ns").(string)
+		collName := strings.TrimPrefix(ns, mg.Name+".")
+		if strings.HasPrefix(collName, "system.") {
+			continue
+		}
+
+		query := CapturedQuery{Coll: collName}
+
+		if command, ok := lookup(doc, "command").(bson.D); ok {
+			query.Filter, _ = lookup(command, "filter").(bson.D)
+			query.Sort, _ = lookup(command, "sort").(bson.D)
+		} else {
+			// legacy profiler output
+			query.Filter, _ = lookup(doc, "query.filter").(bson.D)
+			query.Sort, _ = lookup(doc, "query.sort").(bson.D)
+		}
+
+		result = append(result, query)
+	}
+
+	return result
+}
+
+// AdviseIndexes groups the queries by query shape, runs explain for each shape
+// and proposes an index for query shapes which do a collection scan
+// or examine many more documents than they return.
+func (mg *DB) AdviseIndexes(queries []CapturedQuery) IndexAdvisorReport {
+	result := IndexAdvisorReport{}
+
+	if !mg.dbOkay() {
+		return result
+	}
+
+	mg.Err = nil
+
+	shapes := map[string]int{}
+	for _, query := range queries {
+		shape := queryShapeString(query)
+		if i, found := shapes[shape]; found {
+			result[i].Count++
+			continue
+		}
+
+		shapes[shape] = len(result)
+		result = append(result, IndexAdvice{Coll: query.Coll, Shape: shape, Count: 1,
+			Filter: query.Filter, Sort: query.Sort})
+	}
+
+	existingIndexes := map[string][]IndexInfo{}
+
+	for i := range result {
+		advice := &result[i]
+
+		cmd := bson.D{{Key: "find", Value: advice.Coll}, {Key: "filter", Value: emptyIfNil(advice.Filter)}}
+		if len(advice.Sort) > 0 {
+			cmd = append(cmd, bson.E{Key: "sort", Value: advice.Sort})
+		}
+
+		raw, err := runExplain(mg.Database, cmd, ExecutionStats)
+		mg.Err = err
+		if err != nil {
+			return result
+		}
+
+		advice.Plan = summarizeExplain(raw)
+		advice.Problems = planProblems(advice.Plan)
+		if len(advice.Problems) == 0 {
+			continue
+		}
+
+		advice.Index = esrIndex(advice.Filter, advice.Sort)
+		if len(advice.Index) == 0 {
+			continue
+		}
+
+		if _, found := existingIndexes[advice.Coll]; !found {
+			existingIndexes[advice.Coll] = mg.Coll(advice.Coll).GetIndexes()
+			if mg.Err != nil {
+				return result
+			}
+		}
+
+		if name := coveringIndex(existingIndexes[advice.Coll], advice.Index); name != "" {
+			advice.Problems = append(advice.Problems, "index "+name+" already exists for this query")
+			advice.Index = nil
+			continue
+		}
+
+		keys, _ := bson.MarshalExtJSON(advice.Index, false, false)
+		advice.CreateIndex = fmt.Sprintf("db.Coll(%q).CreateIndex(`%s`)", advice.Coll, keys)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Plan.DocsExamined*int64(result[i].Count) > result[j].Plan.DocsExamined*int64(result[j].Count)
+	})
+
+	return result
+}
+
+// planProblems returns the reasons a query plan is considered inefficient
+func planProblems(plan ExplainSummary) []string {
+	problems := []string{}
+
+	if plan.CollScan {
+		problems = append(problems, "COLLSCAN")
+	}
+
+	returned := plan.NReturned
+	if returned == 0 {
+		returned = 1
+	}
+
+	if plan.DocsExamined > docsExaminedRatio && plan.DocsExamined/returned >= docsExaminedRatio {
+		problems = append(problems, fmt.Sprintf("examined %d documents to return %d", plan.DocsExamined, plan.NReturned))
+	}
+
+	return problems
+}
+
+// coveringIndex returns the name of an existing index which
+// has the same leading keys as the proposed index.
+func coveringIndex(indexes []IndexInfo, proposed bson.D) string {
+	for _, index := range indexes {
+		if index.Hidden || index.PartialFilterExpression != nil {
+			continue
+		}
+
+		if isKeyPrefix(proposed, index.Key) || indexName(proposed) == indexName(index.Key) {
+			return index.Name
+		}
+	}
+
+	return ""
+}
+
+// esrIndex proposes index keys for a query following the Equality, Sort, Range rule.
+// Fields within an $and are included. Fields within an $or are not since each
+// clause of an $or would need its own index.
+func esrIndex(filter bson.D, sortSequence bson.D) bson.D {
+	equality, ranges := []string{}, []string{}
+	classifyFields(filter, len(sortSequence) > 0, &equality, &ranges)
+
+	result := bson.D{}
+	for _, field := range equality {
+		result = appendIndexKey(result, field, 1)
+	}
+
+	for _, e := range sortSequence {
+		direction := 1
+		if n, _ := optInt64(e); n < 0 {
+			direction = -1
+		}
+		result = appendIndexKey(result, e.Key, direction)
+	}
+
+	for _, field := range ranges {
+		result = appendIndexKey(result, field, 1)
+	}
+
+	return result
+}
+
+// appendIndexKey adds a field to index keys if it isn't already there
+func appendIndexKey(keys bson.D, field string, direction int) bson.D {
+	for _, k := range keys {
+		if k.Key == field {
+			return keys
+		}
+	}
+
+	return append(keys, bson.E{Key: field, Value: direction})
+}
+
+// classifyFields adds the fields in a query filter to either the equality or
+// range fields. $in is treated as equality unless the query is sorted.
+func classifyFields(filter bson.D, sorted bool, equality *[]string, ranges *[]string) {
+	for _, e := range filter {
+		if e.Key == "$and" {
+			clauses, _ := e.Value.(bson.A)
+			for _, clause := range clauses {
+				clauseDoc, _ := clause.(bson.D)
+				classifyFields(clauseDoc, sorted, equality, ranges)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+
+		ops, isOps := e.Value.(bson.D)
+		if !isOps || len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+			*equality = append(*equality, e.Key)
+			continue
+		}
+
+		isEquality := true
+		for _, op := range ops {
+			switch op.Key {
+			case "$eq", "$elemMatch":
+			case "$in":
+				if sorted {
+					isEquality = false
+				}
+			default:
+				isEquality = false
+			}
+		}
+
+		if isEquality {
+			*equality = append(*equality, e.Key)
+		} else {
+			*ranges = append(*ranges, e.Key)
+		}
+	}
+}
+
+// queryShape returns a copy of a query filter with the values replaced by "?"
+// so that queries which differ only by values have the same shape.
+func queryShape(filter bson.D) bson.D {
+	result := bson.D{}
+
+	for _, e := range filter {
+		switch v := e.Value.(type) {
+		case bson.A:
+			if e.Key == "$and" || e.Key == "$or" || e.Key == "$nor" {
+				clauses := bson.A{}
+				for _, clause := range v {
+					clauseDoc, _ := clause.(bson.D)
+					clauses = append(clauses, queryShape(clauseDoc))
+				}
+				result = append(result, bson.E{Key: e.Key, Value: clauses})
+				continue
+			}
+
+		case bson.D:
+			if len(v) > 0 && strings.HasPrefix(v[0].Key, "$") {
+				ops := bson.D{}
+				for _, op := range v {
+					opValue := interface{}("?")
+					if opDoc, ok := op.Value.(bson.D); ok && (op.Key == "$elemMatch" || op.Key == "$not") {
+						opValue = queryShape(opDoc)
+					}
+					ops = append(ops, bson.E{Key: op.Key, Value: opValue})
+				}
+				result = append(result, bson.E{Key: e.Key, Value: ops})
+				continue
+			}
+		}
+
+		result = append(result, bson.E{Key: e.Key, Value: "?"})
+	}
+
+	return result
+}
+
+// queryShapeString returns the query shape, including the collection
+// name and sort, as a string which can be used as a map key.
+func queryShapeString(query CapturedQuery) string {
+	shape := bson.D{{Key: "filter", Value: queryShape(query.Filter)}}
+	if len(query.Sort) > 0 {
+		shape = append(shape, bson.E{Key: "sort", Value: query.Sort})
+	}
+
+	json, err := bson.MarshalExtJSON(shape, false, false)
+	if err != nil {
+		return query.Coll + " " + fmt.Sprintf("%v", shape)
+	}
+
+	return query.Coll + " " + string(json)
+}
+
+// emptyIfNil returns an empty bson.D in place of a nil bson.D
+func emptyIfNil(doc bson.D) bson.D {
+	if doc == nil {
+		return bson.D{}
+	}
+
+	return doc
+}
+
+// String returns the IndexAdvisorReport, one query shape at a time
+func (r IndexAdvisorReport) String() string {
+	var buf bytes.Buffer
+
+	for _, advice := range r {
+		fmt.Fprintf(&buf, "%s\n", advice.Shape)
+		fmt.Fprintf(&buf, "   queries: %d, returned: %d, keys examined: %d, docs examined: %d, indexes: %s\n",
+			advice.Count, advice.Plan.NReturned, advice.Plan.KeysExamined, advice.Plan.DocsExamined,
+			strings.Join(advice.Plan.IndexesUsed, ", "))
+
+		if len(advice.Problems) > 0 {
+			fmt.Fprintf(&buf, "   problems: %s\n", strings.Join(advice.Problems, ", "))
+		}
+
+		if advice.CreateIndex != "" {
+			fmt.Fprintf(&buf, "   proposed: %s\n", advice.CreateIndex)
+		}
+	}
+
+	return buf.String()
+}
+
+// Print prints the IndexAdvisorReport
+func (r IndexAdvisorReport) Print() {
+	fmt.Print(r.String())
+}
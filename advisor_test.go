@@ -0,0 +1,125 @@
+package mongolang
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryShape(t *testing.T) {
+	q1 := CapturedQuery{Coll: "zips", Filter: testParseDoc(`{"state":"CA", "pop":{"$gt":1000}}`)}
+	q2 := CapturedQuery{Coll: "zips", Filter: testParseDoc(`{"state":"NY", "pop":{"$gt":5}}`)}
+	q3 := CapturedQuery{Coll: "zips", Filter: testParseDoc(`{"state":"NY", "pop":{"$lt":5}}`)}
+
+	if queryShapeString(q1) != queryShapeString(q2) {
+		t.Errorf("expected same shape for %s and %s", queryShapeString(q1), queryShapeString(q2))
+	}
+
+	if queryShapeString(q1) == queryShapeString(q3) {
+		t.Errorf("expected different shapes for %v and %v", q1, q3)
+	}
+
+	shape := queryShapeString(CapturedQuery{Coll: "zips",
+		Filter: testParseDoc(`{"$or":[{"a":1},{"b":{"$in":[1,2]}}], "c":{"$elemMatch":{"d":5}}}`),
+		Sort:   testParseDoc(`{"pop":-1}`)})
+
+	expected := `zips {"filter":{"$or":[{"a":"?"},{"b":{"$in":"?"}}],"c":{"$elemMatch":{"d":"?"}}},"sort":{"pop":-1}}`
+	if shape != expected {
+		t.Errorf("expected shape %s, got %s", expected, shape)
+	}
+}
+
+func TestESRIndex(t *testing.T) {
+	tests := []struct {
+		filter, sort, index string
+	}{
+		{`{"pop":{"$gt":1000}, "state":"CA"}`, `{"city":-1}`, `{"state":1,"city":-1,"pop":1}`},
+		{`{"$and":[{"state":"CA"}, {"pop":{"$lt":10}}], "city":{"$eq":"X"}}`, `{}`, `{"state":1,"city":1,"pop":1}`},
+		{`{"state":{"$in":["CA","NY"]}}`, `{}`, `{"state":1}`},
+		{`{"state":{"$in":["CA","NY"]}}`, `{"pop":1}`, `{"pop":1,"state":1}`},
+		{`{"state":"CA"}`, `{"state":1,"pop":1}`, `{"state":1,"pop":1}`},
+		{`{"$or":[{"a":1},{"b":1}]}`, `{}`, `{}`},
+	}
+
+	for _, test := range tests {
+		index := esrIndex(testParseDoc(test.filter), testParseDoc(test.sort))
+		json, _ := bson.MarshalExtJSON(index, false, false)
+		if string(json) != test.index {
+			t.Errorf("esrIndex(%s, %s) returned %s instead of %s", test.filter, test.sort, json, test.index)
+		}
+	}
+}
+
+func TestPlanProblems(t *testing.T) {
+	problems := planProblems(ExplainSummary{CollScan: true, NReturned: 2, DocsExamined: 29353})
+	if len(problems) != 2 || problems[0] != "COLLSCAN" {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+
+	problems = planProblems(ExplainSummary{NReturned: 20, DocsExamined: 25})
+	if len(problems) != 0 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+
+	existing := []IndexInfo{indexInfo(testParseDoc(`{"name":"state_1_city_1", "key":{"state":1,"city":1}}`))}
+	if coveringIndex(existing, testParseDoc(`{"state":1}`)) != "state_1_city_1" {
+		t.Error("expected state_1_city_1 to cover {state:1}")
+	}
+
+	if coveringIndex(existing, testParseDoc(`{"city":1}`)) != "" {
+		t.Error("expected no index to cover {city:1}")
+	}
+}
+
+func TestCaptureQuery(t *testing.T) {
+	db := DB{CaptureQueries: true}
+
+	// only the most recent queries are kept
+	db.CapturedQueries = make([]CapturedQuery, maxCapturedQueries)
+	db.captureQuery("zips", bson.D{{Key: "state", Value: "CA"}}, nil)
+
+	n := len(db.CapturedQueries)
+	if n != maxCapturedQueries || db.CapturedQueries[n-1].Coll != "zips" {
+		t.Errorf("expected %d queries ending with the newest, got %d", maxCapturedQueries, n)
+	}
+
+	db.captureQuery("system.profile", bson.D{}, nil)
+	if db.CapturedQueries[len(db.CapturedQueries)-1].Coll != "zips" {
+		t.Error("expected system collection queries not to be captured")
+	}
+}
+
+func TestAdviseIndexes(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	db.CaptureQueries = true
+	db.Coll("zips").Find(`{"state":"CA", "pop":{"$gt":1000}}`).Sort(`{"city":1}`).ToArray()
+	db.Coll("zips").Find(`{"state":"NY", "pop":{"$gt":50}}`).Sort(`{"city":1}`).ToArray()
+	db.Coll("zips").FindOne(`{"_id":"90002"}`)
+	db.CaptureQueries = false
+
+	if len(db.CapturedQueries) != 3 {
+		t.Fatalf("expected 3 captured queries, got %d", len(db.CapturedQueries))
+	}
+
+	report := db.AdviseIndexes(db.CapturedQueries)
+	if db.Err != nil || len(report) != 2 {
+		t.Fatalf("expected advice for 2 query shapes, got %d, error: %v", len(report), db.Err)
+	}
+
+	if report[0].Count != 2 || !report[0].Plan.CollScan ||
+		report[0].CreateIndex != "db.Coll(\"zips\").CreateIndex(`{\"state\":1,\"city\":1,\"pop\":1}`)" {
+		t.Errorf("unexpected advice:\n%s", report)
+	}
+
+	if len(report[1].Problems) != 0 || report[1].CreateIndex != "" {
+		t.Errorf("unexpected advice for _id query:\n%s", report)
+	}
+
+	if !strings.Contains(report.String(), "proposed: db.Coll") {
+		t.Errorf("report did not include proposed index:\n%s", report)
+	}
+}
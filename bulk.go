@@ -0,0 +1,275 @@
+package mongolang
+
+/*
+	Methods to support bulk writes using either MongoDB Go Driver
+	write models or the MongoDB Shell bulkWrite() format:
+
+		db.Coll("testCollection").BulkWrite(`[
+			{"insertOne": {"document": {"_id": 1, "status": "A"}}},
+			{"updateMany": {"filter": {"status": "A"}, "update": {"$set": {"status": "B"}}}},
+			{"deleteOne": {"filter": {"_id": 1}}}
+		]`, `{"ordered": false}`)
+*/
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BulkWriteResult summarizes the result of a BulkWrite,
+// including any errors for individual operations.
+type BulkWriteResult struct {
+	InsertedCount int64
+	MatchedCount  int64
+	ModifiedCount int64
+	DeletedCount  int64
+	UpsertedCount int64
+	UpsertedIDs   map[int64]interface{}
+
+	WriteErrors       []BulkWriteError
+	WriteConcernError string
+}
+
+// BulkWriteError is an error for a single operation in a BulkWrite.
+// Index is the index of the operation in the operations passed to BulkWrite.
+type BulkWriteError struct {
+	Index   int
+	Code    int
+	Message string
+}
+
+// bulkWriteArgs lists the arguments allowed for each
+// MongoDB Shell bulkWrite operation.
+var bulkWriteArgs = map[string][]string{
+	"insertOne":  {"document"},
+	"updateOne":  {"filter", "update", "upsert", "arrayFilters", "collation", "hint"},
+	"updateMany": {"filter", "update", "upsert", "arrayFilters", "collation", "hint"},
+	"replaceOne": {"filter", "replacement", "upsert", "collation", "hint"},
+	"deleteOne":  {"filter", "collation", "hint"},
+	"deleteMany": {"filter", "collation", "hint"},
+}
+
+// BulkWrite performs multiple write operations with a single call.
+// Operations are either a []mongo.WriteModel or, using the MongoDB Shell
+// bulkWrite() format, a JSON string, bson.A or []bson.D.
+// The optional opts[0] is a JSON string, bson.D or bson.M with the options
+// ordered (default true) or bypassDocumentValidation.
+// Note that BulkWrite operations are not journaled.
+func (c *Coll) BulkWrite(operations interface{}, opts ...interface{}) *BulkWriteResult {
+	result := &BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+
+	if !c.collOkay() {
+		return result
+	}
+
+	c.resetErrors()
+
+	models, err := bulkWriteModels(operations)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	bulkOpts, err := bulkWriteOptions(opts)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	mongoResult, err := c.MongoColl.BulkWrite(context.Background(), models, bulkOpts)
+	c.DB.Err = err
+
+	if mongoResult != nil {
+		result.InsertedCount = mongoResult.InsertedCount
+		result.MatchedCount = mongoResult.MatchedCount
+		result.ModifiedCount = mongoResult.ModifiedCount
+		result.DeletedCount = mongoResult.DeletedCount
+		result.UpsertedCount = mongoResult.UpsertedCount
+		for k, v := range mongoResult.UpsertedIDs {
+			result.UpsertedIDs[k] = v
+		}
+	}
+
+	if bulkErr, ok := err.(mongo.BulkWriteException); ok {
+		for _, writeErr := range bulkErr.WriteErrors {
+			result.WriteErrors = append(result.WriteErrors,
+				BulkWriteError{Index: writeErr.Index, Code: writeErr.Code, Message: writeErr.Message})
+		}
+
+		if bulkErr.WriteConcernError != nil {
+			result.WriteConcernError = bulkErr.WriteConcernError.Message
+		}
+	}
+
+	return result
+}
+
+// String returns a summary of the BulkWriteResult
+func (r *BulkWriteResult) String() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "inserted: %d, matched: %d, modified: %d, deleted: %d, upserted: %d\n",
+		r.InsertedCount, r.MatchedCount, r.ModifiedCount, r.DeletedCount, r.UpsertedCount)
+
+	for _, writeErr := range r.WriteErrors {
+		fmt.Fprintf(&buf, "operation %d error %d: %s\n", writeErr.Index, writeErr.Code, writeErr.Message)
+	}
+
+	if r.WriteConcernError != "" {
+		fmt.Fprintf(&buf, "write concern error: %s\n", r.WriteConcernError)
+	}
+
+	return buf.String()
+}
+
+// bulkWriteModels converts the operations passed to BulkWrite to a []mongo.WriteModel
+func bulkWriteModels(operations interface{}) ([]mongo.WriteModel, error) {
+	if models, ok := operations.([]mongo.WriteModel); ok {
+		return models, nil
+	}
+
+	parm, err := verifyParm(operations, bsonDSliceAllowed)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := parm.([]bson.D)
+	models := make([]mongo.WriteModel, len(ops))
+	for i, op := range ops {
+		models[i], err = bulkWriteModel(op)
+		if err != nil {
+			return nil, fmt.Errorf("bulk write operation %d: %v", i, err)
+		}
+	}
+
+	return models, nil
+}
+
+// bulkWriteModel converts a single MongoDB Shell bulkWrite operation,
+// such as {"deleteOne": {"filter": {"_id": 1}}}, to a mongo.WriteModel
+func bulkWriteModel(op bson.D) (mongo.WriteModel, error) {
+	if len(op) != 1 {
+		return nil, fmt.Errorf("operation must have a single key such as insertOne, found %d keys", len(op))
+	}
+
+	opName := op[0].Key
+	allowedArgs, ok := bulkWriteArgs[opName]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized operation: %s", opName)
+	}
+
+	args, err := optDoc(op[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var document, filter, update interface{}
+	var upsert *bool
+	var arrayFilters *options.ArrayFilters
+	var collation *options.Collation
+	var hint interface{}
+
+	for _, arg := range args {
+		if !containsString(allowedArgs, arg.Key) {
+			return nil, fmt.Errorf("unrecognized %s argument: %s", opName, arg.Key)
+		}
+
+		var b bool
+		switch arg.Key {
+		case "document", "replacement":
+			document, err = verifyParm(arg.Value, bsonDAllowed|bsonMAllowed)
+		case "filter":
+			filter, err = verifyParm(arg.Value, bsonDAllowed|bsonMAllowed)
+		case "update":
+			update, err = verifyParm(arg.Value, bsonDAllowed|bsonMAllowed|bsonDSliceAllowed)
+		case "upsert":
+			b, err = optBool(arg)
+			upsert = &b
+		case "arrayFilters":
+			arrayFilters, err = optArrayFilters(arg)
+		case "collation":
+			collation, err = optCollation(arg)
+		case "hint":
+			hint, err = optHint(arg)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s argument %s: %v", opName, arg.Key, err)
+		}
+	}
+
+	// an empty filter must be passed explicitly
+	// rather than updating or deleting every document by default
+	if opName != "insertOne" && filter == nil {
+		return nil, fmt.Errorf("%s requires a filter", opName)
+	}
+
+	switch opName {
+	case "insertOne":
+		if document == nil {
+			return nil, fmt.Errorf("insertOne requires a document")
+		}
+		return &mongo.InsertOneModel{Document: document}, nil
+
+	case "updateOne":
+		if update == nil {
+			return nil, fmt.Errorf("updateOne requires an update")
+		}
+		return &mongo.UpdateOneModel{Filter: filter, Update: update, Upsert: upsert,
+			ArrayFilters: arrayFilters, Collation: collation, Hint: hint}, nil
+
+	case "updateMany":
+		if update == nil {
+			return nil, fmt.Errorf("updateMany requires an update")
+		}
+		return &mongo.UpdateManyModel{Filter: filter, Update: update, Upsert: upsert,
+			ArrayFilters: arrayFilters, Collation: collation, Hint: hint}, nil
+
+	case "replaceOne":
+		if document == nil {
+			return nil, fmt.Errorf("replaceOne requires a replacement")
+		}
+		return &mongo.ReplaceOneModel{Filter: filter, Replacement: document, Upsert: upsert,
+			Collation: collation, Hint: hint}, nil
+
+	case "deleteOne":
+		return &mongo.DeleteOneModel{Filter: filter, Collation: collation, Hint: hint}, nil
+	}
+
+	return &mongo.DeleteManyModel{Filter: filter, Collation: collation, Hint: hint}, nil
+}
+
+// bulkWriteOptions converts the optional opts parm for
+// BulkWrite() to an options.BulkWriteOptions
+func bulkWriteOptions(opts []interface{}) (*options.BulkWriteOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.BulkWrite()
+	for _, e := range doc {
+		var b bool
+		switch e.Key {
+		case "ordered":
+			b, err = optBool(e)
+			result.SetOrdered(b)
+		case "bypassDocumentValidation":
+			b, err = optBool(e)
+			result.SetBypassDocumentValidation(b)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package mongolang
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBulkWriteModels(t *testing.T) {
+	models, err := bulkWriteModels(`[
+		{"insertOne": {"document": {"_id": 1, "status": "A"}}},
+		{"updateOne": {"filter": {"_id": 1}, "update": {"$set": {"status": "B"}}, "upsert": true}},
+		{"updateMany": {"filter": {"status": "B"}, "update": [{"$set": {"status": "C"}}],
+			"arrayFilters": [{"x": 1}], "hint": "status_1"}},
+		{"replaceOne": {"filter": {"_id": 1}, "replacement": {"status": "D"}}},
+		{"deleteOne": {"filter": {"_id": 1}, "collation": {"locale": "en"}}},
+		{"deleteMany": {"filter": {"status": "D"}}}
+	]`)
+
+	if err != nil {
+		t.Fatalf("bulkWriteModels error: %v", err)
+	}
+
+	if len(models) != 6 {
+		t.Fatalf("expected 6 models, got %d", len(models))
+	}
+
+	if m, ok := models[1].(*mongo.UpdateOneModel); !ok || m.Upsert == nil || !*m.Upsert {
+		t.Errorf("expected UpdateOneModel with upsert, got %+v", models[1])
+	}
+
+	if m, ok := models[2].(*mongo.UpdateManyModel); !ok || m.Hint != "status_1" || m.ArrayFilters == nil {
+		t.Errorf("expected UpdateManyModel with hint and arrayFilters, got %+v", models[2])
+	}
+
+	if m, ok := models[4].(*mongo.DeleteOneModel); !ok || m.Collation == nil || m.Collation.Locale != "en" {
+		t.Errorf("expected DeleteOneModel with collation, got %+v", models[4])
+	}
+
+	if _, ok := models[5].(*mongo.DeleteManyModel); !ok {
+		t.Errorf("expected DeleteManyModel, got %T", models[5])
+	}
+
+	// Go models are passed through
+	goModels := []mongo.WriteModel{mongo.NewDeleteOneModel()}
+	models, err = bulkWriteModels(goModels)
+	if err != nil || len(models) != 1 {
+		t.Errorf("expected Go models to be passed through, error: %v", err)
+	}
+
+	invalid := []string{
+		`[{"insertOne": {"doc": {"_id": 1}}}]`,
+		`[{"insertOne": {}}]`,
+		`[{"updateOne": {"filter": {"_id": 1}}}]`,
+		`[{"removeOne": {"filter": {"_id": 1}}}]`,
+		`[{"deleteOne": {"filter": {"_id": 1}}, "deleteMany": {"filter": {}}}]`,
+		`[{"deleteOne": {"filter": {"_id": 1}, "upsert": true}}]`,
+		`[{"deleteOne": 1}]`,
+		`[{"updateOne": {"update": {"$set": {"status": "B"}}}}]`,
+		`[{"updateMany": {"update": {"$set": {"status": "B"}}}}]`,
+		`[{"replaceOne": {"replacement": {"status": "D"}}}]`,
+		`[{"deleteOne": {}}]`,
+		`[{"deleteMany": {"collation": {"locale": "en"}}}]`,
+	}
+
+	for _, s := range invalid {
+		if _, err = bulkWriteModels(s); err == nil {
+			t.Errorf("expected error for bulk write operations %s", s)
+		}
+	}
+}
+
+func TestBulkWrite(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	coll := db.Coll("testCollection")
+	coll.DeleteMany(`{"testCase":"bulk"}`)
+
+	result := coll.BulkWrite(`[
+		{"insertOne": {"document": {"_id": "bulk1", "testCase": "bulk", "status": "A"}}},
+		{"insertOne": {"document": {"_id": "bulk2", "testCase": "bulk", "status": "A"}}},
+		{"updateMany": {"filter": {"testCase": "bulk"}, "update": {"$set": {"status": "B"}}}},
+		{"replaceOne": {"filter": {"_id": "bulk3"}, "replacement": {"testCase": "bulk"}, "upsert": true}},
+		{"deleteOne": {"filter": {"_id": "bulk1"}}}
+	]`)
+
+	if db.Err != nil {
+		t.Fatalf("BulkWrite error: %v", db.Err)
+	}
+
+	if result.InsertedCount != 2 || result.ModifiedCount != 2 ||
+		result.UpsertedCount != 1 || result.DeletedCount != 1 {
+		t.Errorf("unexpected BulkWrite result: %s", result)
+	}
+
+	// unordered with a duplicate key error
+	result = coll.BulkWrite(`[
+		{"insertOne": {"document": {"_id": "bulk2", "testCase": "bulk"}}},
+		{"insertOne": {"document": {"_id": "bulk4", "testCase": "bulk"}}}
+	]`, `{"ordered": false}`)
+
+	if db.Err == nil || len(result.WriteErrors) != 1 || result.WriteErrors[0].Index != 0 ||
+		result.InsertedCount != 1 {
+		t.Errorf("expected one duplicate key error, got: %s", result)
+	}
+
+	if !strings.Contains(result.String(), "operation 0 error 11000") {
+		t.Errorf("String() did not include write error: %s", result)
+	}
+
+	coll.BulkWrite(`[]`, `{"orderd": false}`)
+	if db.Err == nil {
+		t.Error("BulkWrite with invalid option expected error")
+	}
+
+	coll.DeleteMany(`{"testCase":"bulk"}`)
+}
@@ -0,0 +1,328 @@
+package mongolang
+
+/*
+	Change data capture: tail a Collection or Database via a change stream
+	and append each change event to local JSON Lines files, one
+	canonical Extended JSON event per line.
+
+		cdc := db.Coll("zips").CaptureChanges("cdc")
+		cdc.Pipeline = `[{"$match":{"operationType":{"$in":["insert","delete"]}}}]`
+		done := make(chan error)
+		go func() { done <- cdc.Run() }()
+		...
+		cdc.Stop()
+		err := <-done
+
+	Files are named <FilePrefix>-<UTC time>.jsonl and a new file is started
+	whenever the current one reaches MaxFileSize bytes. The resume token for
+	the last change written is saved in <FilePrefix>.token in the same directory.
+	Run() resumes from the saved token so the capture can be restarted without gaps.
+
+	Each change is written and synced to disk before its resume token is saved.
+	If the process stops between the two, the change is written again
+	when the capture restarts, so consumers should expect occasional duplicates.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// defaultMaxFileSize is the default size in bytes at which a new change file is started
+const defaultMaxFileSize = 64 * 1024 * 1024
+
+// ChangeCapture appends the change events for a Collection or Database to rotating
+// JSON Lines files. Pipeline and Options are the same as the Watch() parms,
+// except that any resumeAfter, startAfter or startAtOperationTime option
+// is ignored if there is a saved resume token.
+// Changes is the number of changes written by Run().
+type ChangeCapture struct {
+	Dir         string
+	FilePrefix  string
+	MaxFileSize int64
+
+	Pipeline interface{}
+	Options  interface{}
+
+	Changes int64
+
+	db       *DB
+	coll     *Coll
+	stopped  int32
+	file     *os.File
+	fileSize int64
+	token    []byte
+}
+
+// CaptureChanges returns a ChangeCapture for changes to the collection,
+// writing files to dir with a FilePrefix of the collection name.
+func (c *Coll) CaptureChanges(dir string) *ChangeCapture {
+	return &ChangeCapture{Dir: dir, FilePrefix: c.CollName, MaxFileSize: defaultMaxFileSize, db: c.DB, coll: c}
+}
+
+// CaptureChanges returns a ChangeCapture for changes to every collection in the current
+// Database, writing files to dir with a FilePrefix of the Database name.
+func (mg *DB) CaptureChanges(dir string) *ChangeCapture {
+	return &ChangeCapture{Dir: dir, FilePrefix: mg.Name, MaxFileSize: defaultMaxFileSize, db: mg}
+}
+
+// Run captures changes until Stop() is called or there is an error, which is returned.
+// DB.Err is not changed, so the DB can be used by other goroutines while Run() runs.
+func (cc *ChangeCapture) Run() error {
+	if cc.db == nil {
+		return ErrInvalidChangeStream
+	}
+
+	atomic.StoreInt32(&cc.stopped, 0)
+	defer cc.closeFile()
+
+	cs, err := cc.watch(cc.db.sharedConnection())
+	if err != nil {
+		return err
+	}
+	defer cs.Close()
+
+	for atomic.LoadInt32(&cc.stopped) == 0 {
+		// TryNext waits up to maxAwaitTimeMS for a change so Stop() is noticed promptly
+		if !cs.TryNext() {
+			if err = cs.Err(); err != nil {
+				return err
+			}
+
+			// save any token the server advanced past changes filtered out by the pipeline
+			if err = cc.saveToken(cs.ResumeToken()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		change := cs.Next()
+		if err = cc.writeChange(*change); err == nil {
+			err = cc.saveToken(cs.ResumeToken())
+		}
+
+		if err != nil {
+			return err
+		}
+
+		cc.Changes++
+	}
+
+	return nil
+}
+
+// Stop stops Run(). It is safe to call Stop() from another goroutine.
+// Run() returns once any change being written has been saved.
+func (cc *ChangeCapture) Stop() {
+	atomic.StoreInt32(&cc.stopped, 1)
+}
+
+// TokenPath returns the path of the file containing the saved resume token
+func (cc *ChangeCapture) TokenPath() string {
+	return filepath.Join(cc.Dir, cc.FilePrefix+".token")
+}
+
+// watch opens the change stream using db, resuming from the saved token if there is one
+func (cc *ChangeCapture) watch(db *DB) (*ChangeStream, error) {
+	if err := os.MkdirAll(cc.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	opts, err := cc.watchOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var cs *ChangeStream
+	if cc.coll != nil {
+		cs = db.Coll(cc.coll.CollName).Watch(cc.Pipeline, opts)
+	} else {
+		cs = db.Watch(cc.Pipeline, opts)
+	}
+
+	return cs, db.Err
+}
+
+// sharedConnection returns a DB using the same connection and Database
+// but with its own Err, for a Run() which is called in its own goroutine
+func (mg *DB) sharedConnection() *DB {
+	return &DB{Client: mg.Client, Database: mg.Database, Name: mg.Name}
+}
+
+// watchOptions returns the Watch() options with the saved resume token, if any
+func (cc *ChangeCapture) watchOptions() (bson.D, error) {
+	opts, err := optionsParm([]interface{}{cc.Options})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := cc.loadToken()
+	if err != nil || token == nil {
+		return opts, err
+	}
+
+	result := bson.D{}
+	for _, opt := range opts {
+		switch opt.Key {
+		case "resumeAfter", "startAfter", "startAtOperationTime":
+		default:
+			result = append(result, opt)
+		}
+	}
+
+	return append(result, bson.E{Key: "resumeAfter", Value: token}), nil
+}
+
+// loadToken reads the saved resume token.
+// Returns nil if no token has been saved.
+func (cc *ChangeCapture) loadToken() (bson.D, error) {
+	token, err := readTokenFile(cc.TokenPath())
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	cc.token, err = bson.MarshalExtJSON(token, true, false)
+	return token, err
+}
+
+// saveToken saves the resume token if it has changed
+func (cc *ChangeCapture) saveToken(token bson.D) error {
+	if token == nil {
+		return nil
+	}
+
+	data, err := bson.MarshalExtJSON(token, true, false)
+	if err != nil || bytes.Equal(data, cc.token) {
+		return err
+	}
+
+	if err = writeTokenFile(cc.TokenPath(), token); err != nil {
+		return err
+	}
+
+	cc.token = data
+	return nil
+}
+
+// readTokenFile reads a resume token saved by writeTokenFile.
+// Returns nil if the file doesn't exist or is empty.
+func readTokenFile(path string) (bson.D, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	token := bson.D{}
+	if err = bson.UnmarshalExtJSON(data, true, &token); err != nil {
+		return nil, fmt.Errorf("invalid resume token in %s: %v", path, err)
+	}
+
+	return token, nil
+}
+
+// writeTokenFile saves a resume token as Extended JSON.
+// The token is written and synced to a temporary file which is then renamed
+// so that a partially written token is never left behind, even after a crash.
+func writeTokenFile(path string, token bson.D) error {
+	data, err := bson.MarshalExtJSON(token, true, false)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(append(data, '\n')); err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// writeChange appends a change to the current file, starting a new file if needed
+func (cc *ChangeCapture) writeChange(change bson.D) error {
+	line, err := bson.MarshalExtJSON(change, true, false)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	maxFileSize := cc.MaxFileSize
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxFileSize
+	}
+
+	if cc.file != nil && cc.fileSize > 0 && cc.fileSize+int64(len(line)) > maxFileSize {
+		cc.closeFile()
+	}
+
+	if cc.file == nil {
+		if err = cc.openFile(); err != nil {
+			return err
+		}
+	}
+
+	n, err := cc.file.Write(line)
+	cc.fileSize += int64(n)
+	if err != nil {
+		return err
+	}
+
+	return cc.file.Sync()
+}
+
+// openFile starts a new change file named with the current UTC time
+func (cc *ChangeCapture) openFile() error {
+	name := fmt.Sprintf("%s-%s.jsonl", cc.FilePrefix, time.Now().UTC().Format("20060102T150405.000000"))
+
+	f, err := os.OpenFile(filepath.Join(cc.Dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	cc.file = f
+	cc.fileSize = info.Size()
+	return nil
+}
+
+// closeFile closes the current change file, if any
+func (cc *ChangeCapture) closeFile() {
+	if cc.file != nil {
+		cc.file.Close()
+		cc.file = nil
+		cc.fileSize = 0
+	}
+}
@@ -0,0 +1,138 @@
+package mongolang
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChangeCaptureFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cc := (&Coll{CollName: "zips"}).CaptureChanges(dir)
+	cc.MaxFileSize = 100
+
+	// no saved token, options are unchanged
+	cc.Options = `{"fullDocument":"updateLookup","startAfter":{"_data":"01"}}`
+	opts, err := cc.watchOptions()
+	if err != nil || len(opts) != 2 {
+		t.Errorf("unexpected watch options %v, error: %v", opts, err)
+	}
+
+	change := bson.D{{Key: "_id", Value: bson.D{{Key: "_data", Value: "8263"}}}, {Key: "operationType", Value: "insert"}}
+	for i := 0; i < 3; i++ {
+		if err = cc.writeChange(change); err != nil {
+			t.Fatalf("writeChange error: %v", err)
+		}
+	}
+	cc.closeFile()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "zips-*.jsonl"))
+	if len(files) != 2 {
+		t.Errorf("expected changes to be written to 2 files, got %v", files)
+	}
+
+	data, _ := ioutil.ReadFile(files[0])
+	if strings.Count(string(data), "\n") != 2 || !strings.Contains(string(data), `"operationType":"insert"`) {
+		t.Errorf("unexpected file contents:\n%s", data)
+	}
+
+	// saved token replaces any start option
+	if err = cc.saveToken(bson.D{{Key: "_data", Value: "8264"}}); err != nil {
+		t.Fatalf("saveToken error: %v", err)
+	}
+
+	opts, err = cc.watchOptions()
+	expected := `{"fullDocument":"updateLookup","resumeAfter":{"_data":"8264"}}`
+	if json, _ := bson.MarshalExtJSON(opts, false, false); err != nil || string(json) != expected {
+		t.Errorf("expected watch options %s, got %s, error: %v", expected, json, err)
+	}
+
+	if _, err = os.Stat(cc.TokenPath() + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary token file not removed")
+	}
+
+	// an empty token file, such as one left by a crash, is no token
+	ioutil.WriteFile(cc.TokenPath(), []byte("\n"), 0644)
+	if opts, err = cc.watchOptions(); err != nil || len(opts) != 2 {
+		t.Errorf("expected an empty token file to be ignored, got %v, error: %v", opts, err)
+	}
+
+	ioutil.WriteFile(cc.TokenPath(), []byte("not json"), 0644)
+	if _, err = cc.watchOptions(); err == nil {
+		t.Error("expected error for invalid saved token")
+	}
+}
+
+func TestChangeCaptureErr(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(1)})
+	defer server.close()
+	defer db.Disconnect()
+
+	dir, err := ioutil.TempDir("", "cdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the stand-in server doesn't support change streams
+	// so Run() returns the error without changing DB.Err
+	earlier := errors.New("earlier error")
+	db.Err = earlier
+
+	if err = db.Coll("zips").CaptureChanges(dir).Run(); err == nil || err == earlier {
+		t.Errorf("expected the change stream error, got %v", err)
+	}
+
+	if db.Err != earlier {
+		t.Errorf("expected DB.Err to be unchanged, got %v", db.Err)
+	}
+}
+
+func TestCaptureChanges(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	dir, err := ioutil.TempDir("", "cdc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cc := db.Coll("cdctest").CaptureChanges(dir)
+	cc.Options = `{"maxAwaitTimeMS":100}`
+
+	done := make(chan error)
+	go func() { done <- cc.Run() }()
+
+	// give the change stream time to open
+	time.Sleep(time.Second)
+	db.Coll("cdctest").InsertOne(`{"x":1}`)
+	time.Sleep(time.Second)
+	cc.Stop()
+
+	if err = <-done; err != nil {
+		t.Skipf("change streams not supported, possibly not a replica set: %v", err)
+	}
+
+	if cc.Changes != 1 {
+		t.Errorf("TestCaptureChanges captured %d changes instead of 1", cc.Changes)
+	}
+
+	if _, err = os.Stat(cc.TokenPath()); err != nil {
+		t.Errorf("TestCaptureChanges resume token not saved: %v", err)
+	}
+
+	db.Coll("cdctest").DeleteMany(`{}`)
+}
@@ -0,0 +1,349 @@
+package mongolang
+
+/*
+	Methods to watch a Collection or Database for changes.
+
+		cs := db.Coll("zips").Watch(`[{"$match":{"operationType":"insert"}}]`)
+		for cs.HasNext() {
+			change := cs.Next()
+			...
+		}
+
+	HasNext() and Next() wait for the next change. A change stream never ends
+	on its own so reading stops only when Close() is called, for example from
+	within a ForEach() function, or an error occurs.
+
+	ResumeToken() returns the token for the last change read. Passing it as the
+	resumeAfter or startAfter option restarts the change stream from that point:
+
+		token := cs.ResumeToken()
+		...
+		cs = db.Coll("zips").Watch(nil, bson.D{{Key: "resumeAfter", Value: token}})
+
+	Change streams require a replica set or sharded cluster.
+*/
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Watch returns a ChangeStream for changes to the collection.
+// Parms are optional. If present, the following parms
+// are recognized:
+//
+//	parms[0] - pipeline - bson.A, []bson.D or JSON string with stages to filter or modify the changes, may be nil
+//	parms[1] - options - JSON string, bson.D or bson.M with any of fullDocument, fullDocumentBeforeChange,
+//	           resumeAfter, startAfter, startAtOperationTime, batchSize, maxAwaitTimeMS or collation
+func (c *Coll) Watch(parms ...interface{}) *ChangeStream {
+	result := &ChangeStream{DB: c.DB, IsClosed: true}
+
+	if !c.collOkay() {
+		return result
+	}
+
+	c.resetErrors()
+
+	pipeline, csOpts, err := watchParms(parms)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	result.MongoStream, err = c.MongoColl.Watch(context.Background(), pipeline, csOpts)
+	c.DB.Err = err
+	if err == nil {
+		result.IsClosed = false
+		result.token = resumeToken(result.MongoStream)
+	}
+
+	return result
+}
+
+// Watch returns a ChangeStream for changes to every collection in the current Database.
+// Parms are the same as for Coll.Watch().
+func (mg *DB) Watch(parms ...interface{}) *ChangeStream {
+	result := &ChangeStream{DB: mg, IsClosed: true}
+
+	if !mg.dbOkay() {
+		return result
+	}
+
+	mg.Err = nil
+
+	pipeline, csOpts, err := watchParms(parms)
+	mg.Err = err
+	if err != nil {
+		return result
+	}
+
+	result.MongoStream, err = mg.Database.Watch(context.Background(), pipeline, csOpts)
+	mg.Err = err
+	if err == nil {
+		result.IsClosed = false
+		result.token = resumeToken(result.MongoStream)
+	}
+
+	return result
+}
+
+// watchParms returns the pipeline and options for Watch()
+func watchParms(parms []interface{}) (interface{}, *options.ChangeStreamOptions, error) {
+	var pipeline interface{} = bson.A{}
+
+	if len(parms) > 0 && parms[0] != nil {
+		var err error
+		pipeline, err = verifyParm(parms[0], bsonAAllowed|bsonDSliceAllowed)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	csOpts, err := changeStreamOptions(parms)
+	return pipeline, csOpts, err
+}
+
+// changeStreamOptions converts the optional options parm for Watch()
+// to an options.ChangeStreamOptions
+func changeStreamOptions(parms []interface{}) (*options.ChangeStreamOptions, error) {
+	result := options.ChangeStream()
+	if len(parms) < 2 {
+		return result, nil
+	}
+
+	doc, err := optionsParm(parms[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range doc {
+		var n int64
+		var s string
+		var d time.Duration
+		switch e.Key {
+		case "fullDocument":
+			s, err = optFullDocument(e, "default", "updateLookup", "whenAvailable", "required")
+			result.SetFullDocument(options.FullDocument(s))
+		case "fullDocumentBeforeChange":
+			s, err = optFullDocument(e, "off", "whenAvailable", "required")
+			result.SetFullDocumentBeforeChange(options.FullDocument(s))
+		case "resumeAfter":
+			result.ResumeAfter, err = optDoc(e)
+		case "startAfter":
+			result.StartAfter, err = optDoc(e)
+		case "startAtOperationTime":
+			ts, ok := e.Value.(primitive.Timestamp)
+			if !ok {
+				err = invalidOption(e)
+			}
+			result.SetStartAtOperationTime(&ts)
+		case "batchSize":
+			n, err = optInt64(e)
+			result.SetBatchSize(int32(n))
+		case "maxAwaitTimeMS":
+			d, err = optMaxTime(e)
+			result.SetMaxAwaitTime(d)
+		case "collation":
+			var collation *options.Collation
+			collation, err = optCollation(e)
+			if collation != nil {
+				result.SetCollation(*collation)
+			}
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// optFullDocument verifies the value of a fullDocument or fullDocumentBeforeChange option
+func optFullDocument(opt bson.E, allowed ...string) (string, error) {
+	s, err := optString(opt)
+	if err != nil || !containsString(allowed, s) {
+		return "", invalidOption(opt)
+	}
+
+	return s, nil
+}
+
+// Err returns the error for the related DB, if any
+func (cs *ChangeStream) Err() error {
+	if cs.DB == nil {
+		return ErrInvalidChangeStream
+	}
+
+	return cs.DB.Err
+}
+
+// setErr sets the error for the related DB if there isn't already an error
+func (cs *ChangeStream) setErr(err error) {
+	if cs.Err() == nil {
+		cs.DB.Err = err
+	}
+}
+
+// requireOpenChangeStream returns true if there are no errors
+// and the change stream is open
+func (cs *ChangeStream) requireOpenChangeStream() bool {
+	if cs.Err() != nil {
+		return false
+	}
+
+	if cs.IsClosed {
+		cs.setErr(ErrClosedChangeStream)
+		return false
+	}
+
+	return true
+}
+
+// Close closes the change stream.
+// It is safe to call Close() from within a ForEach() function.
+func (cs *ChangeStream) Close() error {
+	if cs.IsClosed {
+		return ErrClosedChangeStream
+	}
+
+	var err error
+	if cs.MongoStream != nil {
+		err = cs.MongoStream.Close(context.Background())
+	}
+
+	cs.IsClosed = true
+	cs.NextDoc = nil
+
+	return err
+}
+
+// bufferNext waits for the next change and reads it into the ChangeStream buffer.
+// If block is false, returns immediately if no change is available.
+// Returns true if there is a next change.
+// If there is an error, the change stream is closed.
+func (cs *ChangeStream) bufferNext(block bool) bool {
+	var hasNext bool
+	if block {
+		hasNext = cs.MongoStream.Next(context.Background())
+	} else {
+		hasNext = cs.MongoStream.TryNext(context.Background())
+	}
+
+	if !hasNext {
+		if err := cs.MongoStream.Err(); err != nil {
+			cs.setErr(err)
+			cs.Close()
+			return false
+		}
+
+		// the server may advance the token even if there are no matching changes
+		if token := resumeToken(cs.MongoStream); token != nil {
+			cs.token = token
+		}
+		return false
+	}
+
+	cs.nextToken = resumeToken(cs.MongoStream)
+	cs.NextDoc = &bson.D{}
+	if err := cs.MongoStream.Decode(cs.NextDoc); err != nil {
+		cs.setErr(err)
+		cs.Close()
+		return false
+	}
+
+	return true
+}
+
+// HasNext waits for the next change and returns true once there is one.
+// Returns false if the change stream is closed or there is an error.
+// A closed change stream is not an error, so ForEach() can be ended by Close().
+func (cs *ChangeStream) HasNext() bool {
+	if cs.IsClosed && cs.Err() == nil {
+		cs.NextDoc = nil
+		return false
+	}
+
+	if !cs.requireOpenChangeStream() {
+		return false
+	}
+
+	if cs.NextDoc != nil {
+		return true
+	}
+
+	return cs.bufferNext(true)
+}
+
+// TryNext returns true if a change is available without waiting
+// for a new one. A following Next() returns the change.
+func (cs *ChangeStream) TryNext() bool {
+	if !cs.requireOpenChangeStream() {
+		return false
+	}
+
+	if cs.NextDoc != nil {
+		return true
+	}
+
+	return cs.bufferNext(false)
+}
+
+// Next waits for the next change and returns the change event as a bson.D.
+func (cs *ChangeStream) Next() *bson.D {
+	if !cs.requireOpenChangeStream() {
+		return &bson.D{}
+	}
+
+	if cs.NextDoc == nil && !cs.bufferNext(true) {
+		cs.setErr(errors.New("Next() called when there isn't a next change"))
+		return &bson.D{}
+	}
+
+	doc := cs.NextDoc
+	cs.NextDoc = nil
+	cs.token = cs.nextToken
+
+	return doc
+}
+
+// ForEach calls the specified function once for each change as it occurs
+// until the change stream is closed, for example by the function calling Close(),
+// or there is an error.
+func (cs *ChangeStream) ForEach(f func(*bson.D)) {
+	for cs.HasNext() {
+		f(cs.Next())
+	}
+}
+
+// ResumeToken returns the resume token for the last change returned by Next().
+// A change buffered by HasNext() but not yet returned by Next() is not included
+// so that restarting from the token doesn't skip it.
+// The token can be passed as the resumeAfter or startAfter option of Watch().
+// Returns nil if the server has not yet provided a token.
+func (cs *ChangeStream) ResumeToken() bson.D {
+	return cs.token
+}
+
+// resumeToken converts the resume token for a mongo.ChangeStream to a bson.D
+func resumeToken(stream *mongo.ChangeStream) bson.D {
+	raw := stream.ResumeToken()
+	if raw == nil {
+		return nil
+	}
+
+	token := bson.D{}
+	if err := bson.Unmarshal(raw, &token); err != nil {
+		return nil
+	}
+
+	return token
+}
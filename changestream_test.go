@@ -0,0 +1,124 @@
+package mongolang
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWatchParms(t *testing.T) {
+	pipeline, opts, err := watchParms([]interface{}{
+		`[{"$match":{"operationType":"insert"}}]`,
+		`{"fullDocument":"updateLookup", "fullDocumentBeforeChange":"whenAvailable",
+		  "resumeAfter":{"_data":"8263"}, "startAtOperationTime":{"$timestamp":{"t":1600000000,"i":1}},
+		  "maxAwaitTimeMS":500, "batchSize":10}`,
+	})
+
+	if err != nil {
+		t.Fatalf("watchParms error: %v", err)
+	}
+
+	if stages, ok := pipeline.(bson.A); !ok || len(stages) != 1 {
+		t.Errorf("expected 1 stage pipeline, got %v", pipeline)
+	}
+
+	if opts.FullDocument == nil || *opts.FullDocument != "updateLookup" ||
+		opts.FullDocumentBeforeChange == nil || *opts.FullDocumentBeforeChange != "whenAvailable" {
+		t.Errorf("fullDocument options not set: %v, %v", opts.FullDocument, opts.FullDocumentBeforeChange)
+	}
+
+	if token, ok := opts.ResumeAfter.(bson.D); !ok || token[0].Value != "8263" {
+		t.Errorf("resumeAfter not set: %v", opts.ResumeAfter)
+	}
+
+	if opts.StartAtOperationTime == nil || *opts.StartAtOperationTime != (primitive.Timestamp{T: 1600000000, I: 1}) {
+		t.Errorf("startAtOperationTime not set: %v", opts.StartAtOperationTime)
+	}
+
+	if opts.MaxAwaitTime == nil || *opts.MaxAwaitTime != 500*time.Millisecond || *opts.BatchSize != 10 {
+		t.Errorf("maxAwaitTimeMS or batchSize not set: %v, %v", opts.MaxAwaitTime, opts.BatchSize)
+	}
+
+	// nil pipeline watches all changes
+	pipeline, _, err = watchParms([]interface{}{nil, `{"fullDocument":"required"}`})
+	if stages, ok := pipeline.(bson.A); err != nil || !ok || len(stages) != 0 {
+		t.Errorf("expected empty pipeline, got %v, error: %v", pipeline, err)
+	}
+
+	invalid := []interface{}{
+		`{"fullDocument":"off"}`,
+		`{"fullDocumentBeforeChange":"updateLookup"}`,
+		`{"startAtOperationTime":12}`,
+		`{"resumeAfterToken":{}}`,
+	}
+
+	for _, opt := range invalid {
+		if _, _, err = watchParms([]interface{}{nil, opt}); err == nil {
+			t.Errorf("expected error for option %v", opt)
+		}
+	}
+
+	if _, _, err = watchParms([]interface{}{`[{"$match":}]`}); err == nil {
+		t.Error("expected error for an invalid pipeline")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	db.Coll("watchtest").DeleteMany(`{}`)
+
+	cs := db.Coll("watchtest").Watch(`[{"$match":{"operationType":"insert"}}]`, `{"fullDocument":"updateLookup"}`)
+	if db.Err != nil {
+		t.Skipf("change streams not supported, possibly not a replica set: %v", db.Err)
+	}
+	defer cs.Close()
+
+	db.Coll("watchtest").InsertMany(`[{"_id":1}, {"_id":2}]`)
+
+	count := 0
+	cs.ForEach(func(change *bson.D) {
+		count++
+		if lookup(*change, "fullDocument._id") != int32(count) {
+			t.Errorf("TestWatch unexpected change: %v", change)
+		}
+		if count == 1 {
+			cs.Close()
+		}
+	})
+
+	if count != 1 || cs.ResumeToken() == nil {
+		t.Errorf("TestWatch read %d changes, resume token %v", count, cs.ResumeToken())
+	}
+
+	// resume after the first insert
+	cs = db.Coll("watchtest").Watch(nil, bson.D{{Key: "resumeAfter", Value: cs.ResumeToken()}})
+	if !cs.HasNext() || lookup(*cs.Next(), "documentKey._id") != int32(2) {
+		t.Errorf("TestWatch resume didn't return second insert, error: %v", db.Err)
+	}
+	cs.Close()
+
+	db.Coll("watchtest").DeleteMany(`{}`)
+}
+
+func TestClosedChangeStream(t *testing.T) {
+	db := DB{}
+	cs := &ChangeStream{DB: &db, IsClosed: true}
+
+	if cs.HasNext() || db.Err != nil {
+		t.Errorf("expected HasNext() to return false without an error, got %v", db.Err)
+	}
+
+	cs.ForEach(func(*bson.D) { t.Error("unexpected change") })
+	if db.Err != nil {
+		t.Errorf("expected ForEach() to end without an error, got %v", db.Err)
+	}
+
+	if cs.Next(); db.Err != ErrClosedChangeStream {
+		t.Errorf("expected ErrClosedChangeStream from Next(), got %v", db.Err)
+	}
+}
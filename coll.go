@@ -73,6 +73,8 @@ func (c *Coll) NewCursor() *Cursor {
 // are recognized:
 // 	parms[0] - query - bson.M or bson.D defines of which documents to select
 //  parms[1] - projection - bson.M or bson.D defines which fields to retrieve
+// If the last parm is a pointer, such as a pointer to a custom struct,
+// the returned document is also decoded into it.
 func (c *Coll) FindOne(parms ...interface{}) *bson.D {
 
 	if !c.collOkay() {
@@ -81,11 +83,13 @@ func (c *Coll) FindOne(parms ...interface{}) *bson.D {
 
 	c.resetErrors()
 
+	parms, target := decodeTarget(parms)
+
 	var filter interface{}
 	var err error
 
 	if len(parms) > 0 {
-		filter, err = verifyParm(parms[0], bsonDAllowed|bsonMAllowed)
+		filter, err = c.verifyLinted(parms[0], bsonDAllowed|bsonMAllowed, LintFilter)
 		c.setErr(err)
 		if err != nil {
 			return &bson.D{}
@@ -103,16 +107,15 @@ func (c *Coll) FindOne(parms ...interface{}) *bson.D {
 		}
 	}
 
+	c.DB.captureQuery(c.CollName, filter, nil)
 	result := c.MongoColl.FindOne(context.Background(), filter, &findOneOptions)
 	c.setErr(result.Err())
 
-	document := bson.D{}
 	if result.Err() != nil {
-		return &document
+		return &bson.D{}
 	}
 
-	c.DB.Err = result.Decode(&document)
-	return &document
+	return c.decodeSingleResult(result, target)
 }
 
 // Find returns a Cursor
@@ -135,7 +138,7 @@ func (c *Coll) Find(parms ...interface{}) *Cursor {
 	c.resetErrors()
 
 	if len(parms) > 0 {
-		result.Filter, err = verifyParm(parms[0], (bsonDAllowed | bsonMAllowed))
+		result.Filter, err = c.verifyLinted(parms[0], (bsonDAllowed | bsonMAllowed), LintFilter)
 		c.setErr(err)
 		if err != nil {
 			result.Filter = bson.D{}
@@ -157,11 +160,11 @@ func (c *Coll) Find(parms ...interface{}) *Cursor {
 // The pipeline passed can be one of: []bson.D, bson.A, string
 // If bson.A, each entry must be a bson.D
 // If string, must be a valid JSON doc that parses to a valid bson.A
+// The optional parms[0] is a JSON string, bson.D or bson.M with any of the options
+// allowDiskUse, batchSize, cursor, maxTimeMS, collation, hint, comment, let
+// or bypassDocumentValidation.
 func (c *Coll) Aggregate(pipeline interface{}, parms ...interface{}) *Cursor {
 
-	//TODO: process other parms
-	//TODO: what to do if incorrect type of parm passed? Maybe return nil?
-
 	var err error
 
 	result := c.NewCursor()
@@ -174,12 +177,72 @@ func (c *Coll) Aggregate(pipeline interface{}, parms ...interface{}) *Cursor {
 
 	c.resetErrors()
 
-	result.AggrPipeline, err = verifyParm(pipeline, (bsonAAllowed | bsonDSliceAllowed))
+	result.AggrPipeline, err = c.verifyLinted(pipeline, (bsonAAllowed | bsonDSliceAllowed), LintPipeline)
 	c.setErr(err)
+	if err != nil {
+		return result
+	}
 
+	aggrOpts, err := aggregateOptions(parms)
+	c.setErr(err)
+	if err != nil {
+		return result
+	}
+
+	result.AggrOptions = *aggrOpts
 	return result
 }
 
+// CountDocuments returns the number of documents that match the filter.
+// The optional opts[0] is a JSON string, bson.D or bson.M with any of the options
+// skip, limit, collation, hint or maxTimeMS.
+func (c *Coll) CountDocuments(filter interface{}, opts ...interface{}) int64 {
+	if !c.collOkay() {
+		return 0
+	}
+
+	c.resetErrors()
+
+	countFilter, err := c.verifyLinted(filter, bsonDAllowed|bsonMAllowed, LintFilter)
+	c.DB.Err = err
+	if err != nil {
+		return 0
+	}
+
+	countOpts, err := countOptions(opts)
+	c.DB.Err = err
+	if err != nil {
+		return 0
+	}
+
+	count, err := c.MongoColl.CountDocuments(context.Background(), countFilter, countOpts)
+	c.DB.Err = err
+
+	return count
+}
+
+// EstimatedDocumentCount returns an estimate of the number of documents
+// in the collection using collection metadata.
+// The optional opts[0] is a JSON string, bson.D or bson.M with the option maxTimeMS.
+func (c *Coll) EstimatedDocumentCount(opts ...interface{}) int64 {
+	if !c.collOkay() {
+		return 0
+	}
+
+	c.resetErrors()
+
+	countOpts, err := estimatedCountOptions(opts)
+	c.DB.Err = err
+	if err != nil {
+		return 0
+	}
+
+	count, err := c.MongoColl.EstimatedDocumentCount(context.Background(), countOpts)
+	c.DB.Err = err
+
+	return count
+}
+
 // InsertOne inserts one document into the Collection.
 // Document must be a bson.D or bson.M.
 // TODO: implement insert one options
@@ -199,6 +262,10 @@ func (c *Coll) InsertOne(document interface{}, opts ...interface{}) *mongo.Inser
 	result, insertErr := c.MongoColl.InsertOne(context.Background(), insertDocument)
 	c.DB.Err = insertErr
 
+	if insertErr == nil {
+		c.DB.Err = c.journalInsert([]interface{}{result.InsertedID})
+	}
+
 	return result
 }
 
@@ -222,11 +289,21 @@ func (c *Coll) InsertMany(documents interface{}, opts ...interface{}) *mongo.Ins
 	result, insertErr := c.MongoColl.InsertMany(context.Background(), iDocs)
 	c.DB.Err = insertErr
 
+	// journal whatever was inserted, even if some of the documents failed
+	if journalErr := c.journalInsert(insertedIDs(result, insertErr)); insertErr == nil {
+		c.DB.Err = journalErr
+	}
+
+	if result == nil {
+		result = &mongo.InsertManyResult{}
+	}
+
 	return result
 }
 
 // DeleteOne deletes a single document. Note that the filter need not specify a
 // single document but only one document will be deleted.
+// If journaling is enabled, the document is journaled before it is deleted.
 // TODO: implement delete options.
 func (c *Coll) DeleteOne(filter interface{}, opts ...interface{}) *mongo.DeleteResult {
 	if !c.collOkay() {
@@ -235,7 +312,13 @@ func (c *Coll) DeleteOne(filter interface{}, opts ...interface{}) *mongo.DeleteR
 
 	c.resetErrors()
 
-	deleteFilter, err := verifyParm(filter, bsonDAllowed|bsonMAllowed)
+	deleteFilter, err := c.verifyLinted(filter, bsonDAllowed|bsonMAllowed, LintFilter)
+	c.DB.Err = err
+	if err != nil {
+		return &mongo.DeleteResult{}
+	}
+
+	deleteFilter, err = c.journalDelete(deleteFilter, 1)
 	c.DB.Err = err
 	if err != nil {
 		return &mongo.DeleteResult{}
@@ -248,6 +331,7 @@ func (c *Coll) DeleteOne(filter interface{}, opts ...interface{}) *mongo.DeleteR
 }
 
 // DeleteMany can delete many documents with one call as specified by the filter
+// If journaling is enabled, the documents are journaled before they are deleted.
 // TODO: implement delete options.
 func (c *Coll) DeleteMany(filter interface{}, opts ...interface{}) *mongo.DeleteResult {
 	if !c.collOkay() {
@@ -256,7 +340,13 @@ func (c *Coll) DeleteMany(filter interface{}, opts ...interface{}) *mongo.Delete
 
 	c.resetErrors()
 
-	deleteFilter, err := verifyParm(filter, bsonDAllowed|bsonMAllowed)
+	deleteFilter, err := c.verifyLinted(filter, bsonDAllowed|bsonMAllowed, LintFilter)
+	c.DB.Err = err
+	if err != nil {
+		return &mongo.DeleteResult{}
+	}
+
+	deleteFilter, err = c.journalDelete(deleteFilter, 0)
 	c.DB.Err = err
 	if err != nil {
 		return &mongo.DeleteResult{}
@@ -267,3 +357,239 @@ func (c *Coll) DeleteMany(filter interface{}, opts ...interface{}) *mongo.Delete
 
 	return result
 }
+
+// UpdateOne updates a single document. Note that the filter need not specify a
+// single document but only one document will be updated.
+// The update can be an update document, such as `{"$set":{"pop":0}}`,
+// or an aggregation pipeline, such as `[{"$set":{"pop":0}}]`.
+// The optional opts[0] is a JSON string, bson.D or bson.M with any of the options
+// upsert, arrayFilters, collation, hint or bypassDocumentValidation.
+func (c *Coll) UpdateOne(filter interface{}, update interface{}, opts ...interface{}) *mongo.UpdateResult {
+	return c.update(false, filter, update, opts)
+}
+
+// UpdateMany updates all of the documents that match the filter.
+// The update and opts parms are the same as for UpdateOne().
+func (c *Coll) UpdateMany(filter interface{}, update interface{}, opts ...interface{}) *mongo.UpdateResult {
+	return c.update(true, filter, update, opts)
+}
+
+// update performs either an UpdateOne or UpdateMany
+func (c *Coll) update(many bool, filter interface{}, update interface{}, opts []interface{}) *mongo.UpdateResult {
+	if !c.collOkay() {
+		return &mongo.UpdateResult{}
+	}
+
+	c.resetErrors()
+
+	updateFilter, err := c.verifyLinted(filter, bsonDAllowed|bsonMAllowed, LintFilter)
+	c.DB.Err = err
+	if err != nil {
+		return &mongo.UpdateResult{}
+	}
+
+	updateDocument, err := c.verifyLinted(update, bsonDAllowed|bsonMAllowed|bsonDSliceAllowed, LintUpdate)
+	c.DB.Err = err
+	if err != nil {
+		return &mongo.UpdateResult{}
+	}
+
+	updateOpts, err := updateOptions(opts)
+	c.DB.Err = err
+	if err != nil {
+		return &mongo.UpdateResult{}
+	}
+
+	var result *mongo.UpdateResult
+	var updateErr error
+	if many {
+		result, updateErr = c.MongoColl.UpdateMany(context.Background(), updateFilter, updateDocument, updateOpts)
+	} else {
+		result, updateErr = c.MongoColl.UpdateOne(context.Background(), updateFilter, updateDocument, updateOpts)
+	}
+
+	c.DB.Err = updateErr
+	if updateErr != nil {
+		return &mongo.UpdateResult{}
+	}
+
+	return result
+}
+
+// ReplaceOne replaces a single document with the replacement document.
+// Note that the filter need not specify a single document but only one document will be replaced.
+// Replacement must be a bson.D or bson.M and must not contain update operators.
+// The optional opts[0] is a JSON string, bson.D or bson.M with any of the options
+// upsert, collation, hint or bypassDocumentValidation.
+func (c *Coll) ReplaceOne(filter interface{}, replacement interface{}, opts ...interface{}) *mongo.UpdateResult {
+	if !c.collOkay() {
+		return &mongo.UpdateResult{}
+	}
+
+	c.resetErrors()
+
+	replaceFilter, err := c.verifyLinted(filter, bsonDAllowed|bsonMAllowed, LintFilter)
+	c.DB.Err = err
+	if err != nil {
+		return &mongo.UpdateResult{}
+	}
+
+	replaceDocument, err := verifyParm(replacement, bsonDAllowed|bsonMAllowed)
+	c.DB.Err = err
+	if err != nil {
+		return &mongo.UpdateResult{}
+	}
+
+	replaceOpts, err := replaceOptions(opts)
+	c.DB.Err = err
+	if err != nil {
+		return &mongo.UpdateResult{}
+	}
+
+	result, replaceErr := c.MongoColl.ReplaceOne(context.Background(), replaceFilter, replaceDocument, replaceOpts)
+	c.DB.Err = replaceErr
+	if replaceErr != nil {
+		return &mongo.UpdateResult{}
+	}
+
+	return result
+}
+
+// FindOneAndUpdate updates a single document and returns either the original
+// document or, if the option returnDocument is "after", the updated document.
+// The update can be an update document or an aggregation pipeline.
+// The optional opts[0] is a JSON string, bson.D or bson.M with any of the options
+// sort, projection, upsert, returnDocument, arrayFilters, collation, hint,
+// maxTimeMS or bypassDocumentValidation.
+// If the last parm is a pointer, such as a pointer to a custom struct,
+// the returned document is also decoded into it.
+func (c *Coll) FindOneAndUpdate(filter interface{}, update interface{}, opts ...interface{}) *bson.D {
+	if !c.collOkay() {
+		return &bson.D{}
+	}
+
+	c.resetErrors()
+
+	opts, target := decodeTarget(opts)
+
+	updateFilter, err := c.verifyLinted(filter, bsonDAllowed|bsonMAllowed, LintFilter)
+	c.DB.Err = err
+	if err != nil {
+		return &bson.D{}
+	}
+
+	updateDocument, err := c.verifyLinted(update, bsonDAllowed|bsonMAllowed|bsonDSliceAllowed, LintUpdate)
+	c.DB.Err = err
+	if err != nil {
+		return &bson.D{}
+	}
+
+	updateOpts, err := findOneAndUpdateOptions(opts)
+	c.DB.Err = err
+	if err != nil {
+		return &bson.D{}
+	}
+
+	result := c.MongoColl.FindOneAndUpdate(context.Background(), updateFilter, updateDocument, updateOpts)
+	return c.decodeSingleResult(result, target)
+}
+
+// FindOneAndReplace replaces a single document and returns either the original
+// document or, if the option returnDocument is "after", the replacement document.
+// Replacement must be a bson.D or bson.M and must not contain update operators.
+// The optional opts[0] is a JSON string, bson.D or bson.M with any of the options
+// sort, projection, upsert, returnDocument, collation, hint,
+// maxTimeMS or bypassDocumentValidation.
+// If the last parm is a pointer, such as a pointer to a custom struct,
+// the returned document is also decoded into it.
+func (c *Coll) FindOneAndReplace(filter interface{}, replacement interface{}, opts ...interface{}) *bson.D {
+	if !c.collOkay() {
+		return &bson.D{}
+	}
+
+	c.resetErrors()
+
+	opts, target := decodeTarget(opts)
+
+	replaceFilter, err := c.verifyLinted(filter, bsonDAllowed|bsonMAllowed, LintFilter)
+	c.DB.Err = err
+	if err != nil {
+		return &bson.D{}
+	}
+
+	replaceDocument, err := verifyParm(replacement, bsonDAllowed|bsonMAllowed)
+	c.DB.Err = err
+	if err != nil {
+		return &bson.D{}
+	}
+
+	replaceOpts, err := findOneAndReplaceOptions(opts)
+	c.DB.Err = err
+	if err != nil {
+		return &bson.D{}
+	}
+
+	result := c.MongoColl.FindOneAndReplace(context.Background(), replaceFilter, replaceDocument, replaceOpts)
+	return c.decodeSingleResult(result, target)
+}
+
+// FindOneAndDelete deletes a single document and returns the deleted document.
+// The optional opts[0] is a JSON string, bson.D or bson.M with any of the options
+// sort, projection, collation, hint or maxTimeMS.
+// If the last parm is a pointer, such as a pointer to a custom struct,
+// the deleted document is also decoded into it.
+// If journaling is enabled, the deleted document is journaled. Since the whole
+// document must be journaled, a projection can't be used while journaling.
+func (c *Coll) FindOneAndDelete(filter interface{}, opts ...interface{}) *bson.D {
+	if !c.collOkay() {
+		return &bson.D{}
+	}
+
+	c.resetErrors()
+
+	opts, target := decodeTarget(opts)
+
+	deleteFilter, err := c.verifyLinted(filter, bsonDAllowed|bsonMAllowed, LintFilter)
+	c.DB.Err = err
+	if err != nil {
+		return &bson.D{}
+	}
+
+	deleteOpts, err := findOneAndDeleteOptions(opts)
+	c.DB.Err = err
+	if err != nil {
+		return &bson.D{}
+	}
+
+	if c.DB.journaling() && deleteOpts.Projection != nil {
+		c.DB.Err = ErrJournalProjection
+		return &bson.D{}
+	}
+
+	result := c.MongoColl.FindOneAndDelete(context.Background(), deleteFilter, deleteOpts)
+	document := c.decodeSingleResult(result, target)
+
+	if c.DB.Err == nil && c.DB.journaling() {
+		c.DB.Err = c.DB.writeJournal(JournalEntry{Op: JournalDelete, DB: c.MongoColl.Database().Name(), Coll: c.CollName,
+			Docs: []bson.D{*document}})
+	}
+
+	return document
+}
+
+// decodeSingleResult returns the document for a SingleResult as a bson.D.
+// If target is not nil, also decodes the document into target.
+func (c *Coll) decodeSingleResult(result *mongo.SingleResult, target interface{}) *bson.D {
+	document := bson.D{}
+
+	c.DB.Err = result.Decode(&document)
+	if c.DB.Err != nil {
+		return &document
+	}
+
+	if target != nil {
+		c.DB.Err = result.Decode(target)
+	}
+
+	return &document
+}
@@ -6,6 +6,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/text/message"
 )
 
@@ -209,6 +210,157 @@ func TestInsertMany(t *testing.T) {
 	db.Coll("testCollection").DeleteMany(`{"author":"Nic Raboy Jr."}`)
 }
 
+func TestUpdate(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	coll := db.Coll("testCollection")
+	coll.DeleteMany(`{"testCase":"update"}`)
+
+	coll.InsertMany(`[
+		{"testCase":"update", "seq":1, "grades":[80, 90]},
+		{"testCase":"update", "seq":2, "grades":[70, 95]}
+	]`)
+
+	// update document
+	result := coll.UpdateOne(`{"testCase":"update", "seq":1}`, `{"$set":{"status":"A"}}`)
+	if db.Err != nil || result.ModifiedCount != 1 {
+		t.Errorf("UpdateOne modified %d, error: %v", result.ModifiedCount, db.Err)
+	}
+
+	// update with arrayFilters
+	result = coll.UpdateMany(`{"testCase":"update"}`,
+		`{"$set":{"grades.$[g]":100}}`,
+		`{"arrayFilters":[{"g":{"$gte":90}}]}`)
+	if db.Err != nil || result.ModifiedCount != 2 {
+		t.Errorf("UpdateMany modified %d, error: %v", result.ModifiedCount, db.Err)
+	}
+
+	// aggregation pipeline update
+	result = coll.UpdateMany(`{"testCase":"update"}`, `[{"$set":{"total":{"$sum":"$grades"}}}]`)
+	if db.Err != nil || result.ModifiedCount != 2 {
+		t.Errorf("UpdateMany with pipeline modified %d, error: %v", result.ModifiedCount, db.Err)
+	}
+
+	doc := coll.FindOne(`{"testCase":"update", "seq":2}`).Map()
+	if doc["total"] != int32(170) {
+		t.Errorf("expected total of 170, got %v", doc["total"])
+	}
+
+	// upsert
+	result = coll.UpdateOne(`{"testCase":"update", "seq":3}`, `{"$set":{"status":"N"}}`, `{"upsert":true}`)
+	if db.Err != nil || result.UpsertedID == nil {
+		t.Errorf("UpdateOne upsert did not insert a document, error: %v", db.Err)
+	}
+
+	// replace
+	result = coll.ReplaceOne(`{"testCase":"update", "seq":3}`, `{"testCase":"update", "seq":4}`)
+	if db.Err != nil || result.ModifiedCount != 1 {
+		t.Errorf("ReplaceOne modified %d, error: %v", result.ModifiedCount, db.Err)
+	}
+
+	// errors
+	coll.UpdateOne(`{"testCase":"update"}`, bson.A{})
+	if db.Err == nil {
+		t.Error("UpdateOne with invalid update expected error")
+	}
+
+	coll.UpdateOne(`{"testCase":"update"}`, `{"$set":{"status":"B"}}`, `{"upsrt":true}`)
+	if db.Err == nil {
+		t.Error("UpdateOne with invalid option expected error")
+	}
+
+	coll.ReplaceOne(`{"testCase":"update"}`, `[{"$set":{"status":"B"}}]`)
+	if db.Err == nil {
+		t.Error("ReplaceOne with pipeline expected error")
+	}
+
+	coll.DeleteMany(`{"testCase":"update"}`)
+}
+
+type counter struct {
+	ID  string `bson:"_id"`
+	Seq int
+}
+
+func TestFindOneAndModify(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	coll := db.Coll("testCollection")
+	coll.DeleteMany(`{"_id":"testCounter"}`)
+
+	// counter, upserted on first call
+	var c counter
+	coll.FindOneAndUpdate(`{"_id":"testCounter"}`, `{"$inc":{"seq":1}}`,
+		`{"upsert":true, "returnDocument":"after"}`, &c)
+	if db.Err != nil || c.Seq != 1 {
+		t.Errorf("FindOneAndUpdate returned seq %d, error: %v", c.Seq, db.Err)
+	}
+
+	// returns the document before the update by default
+	doc := coll.FindOneAndUpdate(`{"_id":"testCounter"}`, `{"$inc":{"seq":1}}`)
+	if db.Err != nil || doc.Map()["seq"] != int32(1) {
+		t.Errorf("FindOneAndUpdate returned %v, error: %v", doc, db.Err)
+	}
+
+	doc = coll.FindOneAndReplace(`{"_id":"testCounter"}`, `{"seq":10}`,
+		`{"returnDocument":"after", "projection":{"_id":0}}`)
+	if db.Err != nil || len(*doc) != 1 || doc.Map()["seq"] != int32(10) {
+		t.Errorf("FindOneAndReplace returned %v, error: %v", doc, db.Err)
+	}
+
+	c = counter{}
+	coll.FindOneAndDelete(`{"_id":"testCounter"}`, &c)
+	if db.Err != nil || c.Seq != 10 {
+		t.Errorf("FindOneAndDelete returned %+v, error: %v", c, db.Err)
+	}
+
+	// no document found
+	coll.FindOneAndDelete(`{"_id":"testCounter"}`)
+	if db.Err != mongo.ErrNoDocuments {
+		t.Errorf("expected ErrNoDocuments, got %v", db.Err)
+	}
+
+	coll.FindOneAndUpdate(`{"_id":"testCounter"}`, `{"$inc":{"seq":1}}`, `{"returnDocument":"new"}`)
+	if db.Err == nil {
+		t.Error("FindOneAndUpdate with invalid returnDocument expected error")
+	}
+}
+
+func TestCountDocuments(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	count := db.Coll("zips").CountDocuments(`{"state":"CA"}`)
+	if db.Err != nil || count != 1516 {
+		t.Errorf("CountDocuments returned %d instead of 1516, error: %v", count, db.Err)
+	}
+
+	count = db.Coll("zips").CountDocuments(`{"state":"CA"}`, `{"skip":1510, "limit":10}`)
+	if db.Err != nil || count != 6 {
+		t.Errorf("CountDocuments with skip and limit returned %d instead of 6, error: %v", count, db.Err)
+	}
+
+	count = db.Coll("zips").EstimatedDocumentCount()
+	if db.Err != nil || count < 1516 {
+		t.Errorf("EstimatedDocumentCount returned %d, error: %v", count, db.Err)
+	}
+
+	db.Coll("zips").CountDocuments(`{"state":"CA"}`, `{"skip":"1"}`)
+	if db.Err == nil {
+		t.Error("CountDocuments with invalid skip expected error")
+	}
+
+	db.Coll("zips").EstimatedDocumentCount(`{"skip":1}`)
+	if db.Err == nil {
+		t.Error("EstimatedDocumentCount with invalid option expected error")
+	}
+}
+
 // dbTest tests that we received the expected error from a call
 // where the DB is not connected
 func testErrNotConnectedDB(db DB, t *testing.T, f string) {
@@ -253,6 +405,30 @@ func TestErr(t *testing.T) {
 	db.Coll("testCollection").DeleteMany("{}")
 	testErrNotConnectedDB(db, t, "DeleteMany()")
 
+	db.Coll("testCollection").UpdateOne("{}", `{"$set":{"a":1}}`)
+	testErrNotConnectedDB(db, t, "UpdateOne()")
+
+	db.Coll("testCollection").UpdateMany("{}", `{"$set":{"a":1}}`)
+	testErrNotConnectedDB(db, t, "UpdateMany()")
+
+	db.Coll("testCollection").ReplaceOne("{}", `{"a":1}`)
+	testErrNotConnectedDB(db, t, "ReplaceOne()")
+
+	db.Coll("testCollection").FindOneAndUpdate("{}", `{"$set":{"a":1}}`)
+	testErrNotConnectedDB(db, t, "FindOneAndUpdate()")
+
+	db.Coll("testCollection").FindOneAndReplace("{}", `{"a":1}`)
+	testErrNotConnectedDB(db, t, "FindOneAndReplace()")
+
+	db.Coll("testCollection").FindOneAndDelete("{}")
+	testErrNotConnectedDB(db, t, "FindOneAndDelete()")
+
+	db.Coll("zips").CountDocuments("{}")
+	testErrNotConnectedDB(db, t, "CountDocuments()")
+
+	db.Coll("zips").EstimatedDocumentCount()
+	testErrNotConnectedDB(db, t, "EstimatedDocumentCount()")
+
 	// test for reset error in FindOne()
 	db.Use("quickstart")
 	coll = db.Coll("zips")
@@ -12,26 +12,27 @@ package mongolang
 
 	   cursor := db.Coll("podcosts").Find().Sort(bson.M{}).Skip(10).Limit(100)
 
-	In the above call note that:
-	   - .Find() must be the first cursor method - it actually creates the cursor struct
-	   - .Sort(), .Skip(), .Limit() can be in any order after the .find()
-	   - no documents have yet been returned and therefore no DB reads have occurred
-
-	The following commands will then actually retrieve a document and begin db reads.
-	Once these cursor methods are called none of the previously mentioned methods can be called
-	on the same cursor.
-		- HasNext()		- Next()		- ForEach()
-		- ToArray()		- Count()		- Pretty()
-		- Close()		- IsClosed
-
-	HasNext() and Next() will access the next document in the cursor (if one exists).
-	If no next document exists, the cursor will be closed.
-	IsClosed() returns true if the cursor is closed.
-	All others will close the cursor after reading all of the documents for the cursor.
-	Once the cursor is closed any attempt to use it will cause a panic.
-
-	TODO: methods which read the remaining documents should check to see if one was buffered via
-	a HasNext()
+	A cursor is always in one of three states:
+
+	   - pending - created by Find() or Aggregate() but no documents read.
+	     .Sort(), .Skip(), .Limit() and the other options such as .Projection(),
+	     .Hint() or .BatchSize() can be called, in any order, only in this state.
+	     Size() and Count() have the server count the documents without reading them.
+	   - reading - HasNext() or Next() has read at least one document.
+	     HasNext() may have buffered the next document in NextDoc.
+	     Size() still counts all of the documents and leaves the cursor open.
+	   - closed - all documents have been read, Close() was called or there was an error.
+
+	The remaining documents for a cursor are any document buffered by HasNext() followed
+	by the documents not yet read from the server. Documents returned by Next() are never
+	returned again. The following read the remaining documents and then close the cursor:
+
+	   - ForEach()		- ForEachWhile()	- ForEachDecode()
+	   - ToArray()		- Pretty()		- String()
+	   - Count() (once reading, counts the remaining documents)
+
+	HasNext() returns false once the cursor is closed. Any other method called for a
+	closed cursor sets the error ErrClosedCursor. A closed cursor can't be reopened.
 */
 
 import (
@@ -39,6 +40,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"time"
 
 	"errors"
 
@@ -95,6 +98,41 @@ func (c *Cursor) requireOpenFindCursor() bool {
 	return false
 }
 
+// requireOpenAggregateCursor returns true if the cursor is an open Aggregate() cursor
+func (c *Cursor) requireOpenAggregateCursor() bool {
+	if !c.requireOpenCursor() {
+		return false
+	}
+
+	if c.IsFindCursor {
+		c.setErr(ErrNotAggregateCursor)
+		return false
+	}
+
+	return true
+}
+
+// requirePendingCursor returns true if the cursor is open and
+// hasn't started reading, so that the options can still be changed.
+func (c *Cursor) requirePendingCursor() bool {
+	if !c.requireOpenCursor() {
+		return false
+	}
+
+	if c.MongoCursor != nil {
+		c.setErr(ErrCursorStarted)
+		return false
+	}
+
+	return true
+}
+
+// requirePendingFindCursor returns true if the cursor is an open Find() cursor
+// which hasn't started reading, so that the find options can still be changed.
+func (c *Cursor) requirePendingFindCursor() bool {
+	return c.requireOpenFindCursor() && c.requirePendingCursor()
+}
+
 // setErr if this is a properly established cursor
 // and there isn't already an error.
 func (c *Cursor) setErr(err error) {
@@ -103,8 +141,8 @@ func (c *Cursor) setErr(err error) {
 	}
 }
 
-// Close closes a cursor
-// Note that it's possible to reuse the cursor, though not recommended?
+// Close closes a cursor, discarding any remaining documents.
+// A closed cursor can't be reused.
 func (c *Cursor) Close() error {
 	var err error
 	if !c.IsClosed {
@@ -122,6 +160,7 @@ func (c *Cursor) Close() error {
 
 		c.AggrPipeline = nil
 		c.AggrOptions = options.AggregateOptions{}
+		c.aggrSort, c.aggrSkip, c.aggrLimit = nil, nil, nil
 	} else {
 		err = ErrClosedCursor
 	}
@@ -136,9 +175,10 @@ func (c *Cursor) getMongoCursor() error {
 	if c.MongoCursor == nil {
 		var err error
 		if c.IsFindCursor {
+			c.Collection.DB.captureQuery(c.Collection.CollName, c.Filter, c.FindOptions.Sort)
 			c.MongoCursor, err = c.Collection.MongoColl.Find(context.Background(), c.Filter, &c.FindOptions)
 		} else {
-			c.MongoCursor, err = c.Collection.MongoColl.Aggregate(context.Background(), c.AggrPipeline, &c.AggrOptions)
+			c.MongoCursor, err = c.Collection.MongoColl.Aggregate(context.Background(), c.pipeline(), &c.AggrOptions)
 		}
 
 		// mark as not closed here so that if error, c.Close() reinitializes cursor
@@ -172,7 +212,10 @@ func (c *Cursor) bufferNext() bool {
 	hasNext := c.MongoCursor.Next(context.Background())
 
 	if !hasNext {
+		// Don't lose any error from the Next call
+		err = c.MongoCursor.Err()
 		c.Close()
+		c.setErr(err)
 		return false
 	}
 
@@ -181,27 +224,41 @@ func (c *Cursor) bufferNext() bool {
 
 	if err != nil {
 		c.Close()
-		// Close will set c.Err
 		// Don't lose error from Decode call
-		c.NextDoc = nil
+		c.setErr(err)
 		return false
 	}
 
 	return true
 }
 
-// sort, skip, limit - pre-cursor open methods
+// sort, skip, limit and other options - pre-cursor open methods
+//
+// Sort, Skip, Limit, BatchSize, MaxTimeMS, Hint, Collation, Comment, Let
+// and AllowDiskUse are also allowed on an aggregate cursor. The others are NOT.
 //
-// NOT allowed on aggregate cursor
+// For an aggregate cursor, Sort, Skip and Limit add $sort, $skip and $limit
+// stages, in that order, to the end of the pipeline when it is run,
+// or before a final $out or $merge stage.
+// As with a find cursor, the order they are called in doesn't matter.
 
 // Sort specifies the bson.D to be used to sort the cursor results
 func (c *Cursor) Sort(sortSequence interface{}) *Cursor {
-	var err error
-	if c.requireOpenFindCursor() {
-		c.FindOptions.Sort, err = verifyParm(sortSequence, (bsonDAllowed | bsonMAllowed))
-		if err != nil {
-			c.setErr(err)
-		}
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	sortDoc, err := verifyParm(sortSequence, (bsonDAllowed | bsonMAllowed))
+	c.setErr(err)
+	if err != nil {
+		return c
+	}
+
+	if c.IsFindCursor {
+		c.FindOptions.Sort = sortDoc
+	} else {
+		c.aggrSort, err = toBsonD(sortDoc)
+		c.setErr(err)
 	}
 
 	return c
@@ -209,8 +266,14 @@ func (c *Cursor) Sort(sortSequence interface{}) *Cursor {
 
 // Skip specifies the number of documents to skip before returning the first document
 func (c *Cursor) Skip(skipCount int64) *Cursor {
-	if c.requireOpenFindCursor() {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	if c.IsFindCursor {
 		c.FindOptions.Skip = &skipCount
+	} else {
+		c.aggrSkip = &skipCount
 	}
 
 	return c
@@ -218,13 +281,255 @@ func (c *Cursor) Skip(skipCount int64) *Cursor {
 
 // Limit specifies the max number of documents to return
 func (c *Cursor) Limit(limitCount int64) *Cursor {
-	if c.requireOpenFindCursor() {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	if c.IsFindCursor {
 		c.FindOptions.Limit = &limitCount
+	} else {
+		c.aggrLimit = &limitCount
+	}
+
+	return c
+}
+
+// pipeline returns the aggregation pipeline for an aggregate cursor
+// with the stages for any Sort(), Skip() and Limit() added to the end,
+// or before a final $out or $merge stage.
+func (c *Cursor) pipeline() bson.A {
+	stages := []bson.D{}
+
+	if len(c.aggrSort) > 0 {
+		stages = append(stages, bson.D{{Key: "$sort", Value: c.aggrSort}})
+	}
+
+	if c.aggrSkip != nil && *c.aggrSkip > 0 {
+		stages = append(stages, bson.D{{Key: "$skip", Value: *c.aggrSkip}})
+	}
+
+	// as for a find, a limit of 0 is no limit and a negative limit is the same as a positive one
+	if c.aggrLimit != nil && *c.aggrLimit != 0 {
+		limit := *c.aggrLimit
+		if limit < 0 {
+			limit = -limit
+		}
+		stages = append(stages, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	return appendStages(c.AggrPipeline, stages...)
+}
+
+// Projection specifies the fields to return, such as `{"city":1,"state":1,"_id":0}`
+func (c *Cursor) Projection(projection interface{}) *Cursor {
+	var err error
+	if c.requirePendingFindCursor() {
+		c.FindOptions.Projection, err = verifyParm(projection, (bsonDAllowed | bsonMAllowed))
+		c.setErr(err)
+	}
+
+	return c
+}
+
+// BatchSize specifies the number of documents returned by the server in each batch
+func (c *Cursor) BatchSize(size int32) *Cursor {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	if c.IsFindCursor {
+		c.FindOptions.SetBatchSize(size)
+	} else {
+		c.AggrOptions.SetBatchSize(size)
+	}
+
+	return c
+}
+
+// MaxTimeMS specifies the maximum time in milliseconds the server may spend on the query
+func (c *Cursor) MaxTimeMS(ms int64) *Cursor {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	if c.IsFindCursor {
+		c.FindOptions.SetMaxTime(time.Duration(ms) * time.Millisecond)
+	} else {
+		c.AggrOptions.SetMaxTime(time.Duration(ms) * time.Millisecond)
+	}
+
+	return c
+}
+
+// Hint forces the use of an index given either the index name
+// or the index keys, such as `{"state":1,"pop":-1}`.
+func (c *Cursor) Hint(nameOrKeys interface{}) *Cursor {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	hint, err := indexNameOrKeys(nameOrKeys)
+	c.setErr(err)
+	if err != nil {
+		return c
+	}
+
+	if c.IsFindCursor {
+		c.FindOptions.Hint = hint
+	} else {
+		c.AggrOptions.Hint = hint
+	}
+
+	return c
+}
+
+// Collation specifies the collation for string comparisons,
+// such as `{"locale":"en","strength":2}`
+func (c *Cursor) Collation(collation interface{}) *Cursor {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	collationOpt, err := cursorCollation(collation)
+	c.setErr(err)
+	if err != nil {
+		return c
+	}
+
+	if c.IsFindCursor {
+		c.FindOptions.Collation = collationOpt
+	} else {
+		c.AggrOptions.Collation = collationOpt
+	}
+
+	return c
+}
+
+// Comment attaches a comment to the query which appears in the
+// server logs and profiler output
+func (c *Cursor) Comment(comment string) *Cursor {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	if c.IsFindCursor {
+		c.FindOptions.SetComment(comment)
+	} else {
+		c.AggrOptions.SetComment(comment)
+	}
+
+	return c
+}
+
+// Let specifies variables, such as `{"minPop":10000}`, which can be
+// used as $$minPop in the query or pipeline. Requires MongoDB 5.0 or later.
+func (c *Cursor) Let(vars interface{}) *Cursor {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	let, err := verifyParm(vars, (bsonDAllowed | bsonMAllowed))
+	c.setErr(err)
+	if err != nil {
+		return c
+	}
+
+	if c.IsFindCursor {
+		c.FindOptions.Let = let
+	} else {
+		c.AggrOptions.Let = let
+	}
+
+	return c
+}
+
+// Min specifies the inclusive lower bound for the index
+// used by the query, such as `{"pop":1000}`. Requires Hint().
+func (c *Cursor) Min(min interface{}) *Cursor {
+	var err error
+	if c.requirePendingFindCursor() {
+		c.FindOptions.Min, err = verifyParm(min, (bsonDAllowed | bsonMAllowed))
+		c.setErr(err)
+	}
+
+	return c
+}
+
+// Max specifies the exclusive upper bound for the index
+// used by the query, such as `{"pop":5000}`. Requires Hint().
+func (c *Cursor) Max(max interface{}) *Cursor {
+	var err error
+	if c.requirePendingFindCursor() {
+		c.FindOptions.Max, err = verifyParm(max, (bsonDAllowed | bsonMAllowed))
+		c.setErr(err)
+	}
+
+	return c
+}
+
+// ReturnKey specifies whether to return only the index keys instead of the documents
+func (c *Cursor) ReturnKey(enabled bool) *Cursor {
+	if c.requirePendingFindCursor() {
+		c.FindOptions.SetReturnKey(enabled)
 	}
 
 	return c
 }
 
+// ShowRecordID adds the internal record id to each document as $recordId
+func (c *Cursor) ShowRecordID() *Cursor {
+	if c.requirePendingFindCursor() {
+		c.FindOptions.SetShowRecordID(true)
+	}
+
+	return c
+}
+
+// NoCursorTimeout prevents the server from timing out the cursor when idle
+func (c *Cursor) NoCursorTimeout() *Cursor {
+	if c.requirePendingFindCursor() {
+		c.FindOptions.SetNoCursorTimeout(true)
+	}
+
+	return c
+}
+
+// AllowPartialResults returns the results from the available shards
+// of a sharded cluster instead of an error if some shards are unavailable
+func (c *Cursor) AllowPartialResults() *Cursor {
+	if c.requirePendingFindCursor() {
+		c.FindOptions.SetAllowPartialResults(true)
+	}
+
+	return c
+}
+
+// AllowDiskUse allows the server to write temporary files for large sorts.
+// The optional allow parm defaults to true.
+func (c *Cursor) AllowDiskUse(allow ...bool) *Cursor {
+	if !c.requirePendingCursor() {
+		return c
+	}
+
+	if c.IsFindCursor {
+		c.FindOptions.SetAllowDiskUse(len(allow) == 0 || allow[0])
+	} else {
+		c.AggrOptions.SetAllowDiskUse(len(allow) == 0 || allow[0])
+	}
+
+	return c
+}
+
+// cursorCollation converts a collation JSON string, bson.D or bson.M to an options.Collation
+func cursorCollation(collation interface{}) (*options.Collation, error) {
+	doc, err := verifyParm(collation, (bsonDAllowed | bsonMAllowed))
+	if err != nil {
+		return nil, err
+	}
+
+	return optCollation(bson.E{Key: "collation", Value: doc})
+}
+
 /*
 	HasNext() and Next() - used to read through a cursor.
 	Closes the cursor if no next document.
@@ -232,7 +537,13 @@ func (c *Cursor) Limit(limitCount int64) *Cursor {
 */
 
 // HasNext returns true if the cursor has a next document available.
+// Returns false, without an error, if the cursor is closed.
 func (c *Cursor) HasNext() bool {
+	if c.IsClosed && c.Err() == nil {
+		c.NextDoc = nil
+		return false
+	}
+
 	if !c.requireOpenCursor() {
 		c.NextDoc = nil
 		return false
@@ -246,8 +557,9 @@ func (c *Cursor) HasNext() bool {
 }
 
 // Next returns the next document for the cursor as a bson.D struct.
-// TODO: allow a struct to be passed similar to cursor.ToArray(...)
-func (c *Cursor) Next() *bson.D {
+// The optional parm is a pointer, such as a pointer to a custom struct,
+// which the document is also decoded into.
+func (c *Cursor) Next(parm ...interface{}) *bson.D {
 	if !c.requireOpenCursor() {
 		return &bson.D{}
 	}
@@ -264,34 +576,106 @@ func (c *Cursor) Next() *bson.D {
 	doc := c.NextDoc
 	c.NextDoc = nil
 
+	if len(parm) > 0 {
+		c.setErr(decodeDoc(*doc, parm[0]))
+	}
+
 	return doc
 }
 
 /*
 	Read all of the documents for a cursor then close the cursor.
 
-	- ForEach()		- ToArray()		- Count()		- Pretty()
+	- ForEach()		- ForEachWhile() (may stop early)
+	- ToArray()		- Pretty()
 	- String() (fulfills the Stringer interface for printing, etc.)
 
+	Count the documents for a cursor without reading them.
+
+	- Count() (closes the cursor)	- Size()
+
 */
 
 // ForEach calls the specified function once for each remaining cursor document
-// passing the function a bson.D document.
+// passing the function a bson.D document, then closes the cursor.
+// Documents are read one at a time, including any document
+// already buffered by HasNext().
 func (c *Cursor) ForEach(f func(*bson.D)) {
-	fmt.Println("ForEach(...) not yet implemented")
+	c.ForEachWhile(func(doc *bson.D) (bool, error) {
+		f(doc)
+		return true, nil
+	})
+}
+
+// ForEachDecode calls the specified function for each remaining cursor document
+// decoded into a new custom struct, then closes the cursor.
+// The function must take a single pointer parm, for example:
+//
+//	cursor.ForEachDecode(func(zip *Zip) { fmt.Println(zip.City) })
+func (c *Cursor) ForEachDecode(f interface{}) {
+	fv, docType, err := decodeFunc(f)
+	if err != nil {
+		c.setErr(err)
+		return
+	}
+
+	c.ForEachWhile(func(doc *bson.D) (bool, error) {
+		v := reflect.New(docType)
+		if err := decodeDoc(*doc, v.Interface()); err != nil {
+			return false, err
+		}
+
+		fv.Call([]reflect.Value{v})
+		return true, nil
+	})
+}
+
+// decodeFunc verifies that f is a func with a single pointer parm and no results.
+// Returns f as a reflect.Value and the type the parm points to.
+func decodeFunc(f interface{}) (reflect.Value, reflect.Type, error) {
+	fv := reflect.ValueOf(f)
+	if fv.Kind() != reflect.Func || fv.Type().NumIn() != 1 || fv.Type().NumOut() != 0 ||
+		fv.Type().In(0).Kind() != reflect.Ptr {
+		return fv, nil, fmt.Errorf("ForEachDecode requires a func with a single pointer parm, not %T", f)
+	}
+
+	return fv, fv.Type().In(0).Elem(), nil
+}
+
+// ForEachWhile calls the specified function for each remaining cursor document
+// until the function returns false or an error, then closes the cursor.
+// An error returned by the function is available via Err().
+func (c *Cursor) ForEachWhile(f func(*bson.D) (bool, error)) {
+	if !c.requireOpenCursor() {
+		return
+	}
+
+	// the function may close the cursor
+	for !c.IsClosed && (c.NextDoc != nil || c.bufferNext()) {
+		doc := c.NextDoc
+		c.NextDoc = nil
+
+		more, err := f(doc)
+		if err != nil {
+			c.setErr(err)
+			break
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	if !c.IsClosed {
+		c.setErr(c.Close())
+	}
 }
 
 // ToArray returns all of the remaining documents for a cursor
-// in a bson.D slice. NOTE: currently seems to return all docs
-// even those already read via a cursor.Next() call.
+// in a bson.D slice and closes the cursor.
 // Optional parm is a pointer to a slice which typically would contain
-// a custom struct or bson.A struct. In this case, ToArray returns an
-// empty []bson.D slice.
-// This may change at some future date but currently it is difficult
-// to deal with a slice of any type. For consistency with Mongo Shell
-// ToArray should return a slice. However we also need the ability
-// to return all of the documents to a slice which is a custom struct
-// or a bson.A struct.
+// a custom struct or bson.A struct. In this case, the remaining documents
+// are decoded into the slice and ToArray returns an empty []bson.D slice.
 func (c *Cursor) ToArray(parm ...interface{}) []bson.D {
 	result := []bson.D{}
 
@@ -299,31 +683,181 @@ func (c *Cursor) ToArray(parm ...interface{}) []bson.D {
 		return result
 	}
 
-	err := c.getMongoCursor()
-
-	if err != nil {
+	docs := c.remainingDocs()
+	if c.Err() != nil {
 		return result
 	}
 
 	if len(parm) > 0 {
-		err = c.MongoCursor.All(context.Background(), parm[0])
-	} else {
-		err = c.MongoCursor.All(context.Background(), &result)
+		c.setErr(decodeDocs(docs, parm[0]))
+		return result
 	}
 
-	c.MongoCursor = nil
-	c.Close()
-	c.setErr(err)
+	return docs
+}
+
+// remainingDocs reads the remaining documents, starting with any
+// document buffered by HasNext(), then closes the cursor.
+// Any error is recorded for the cursor.
+func (c *Cursor) remainingDocs() []bson.D {
+	result := []bson.D{}
+
+	for !c.IsClosed && (c.NextDoc != nil || c.bufferNext()) {
+		result = append(result, *c.NextDoc)
+		c.NextDoc = nil
+	}
 
 	return result
 }
 
-// Count returns a count of the (remaining) documents for the cursor.
+// decodeDocs decodes documents into the slice that v points to,
+// replacing any elements already in the slice.
+func decodeDocs(docs []bson.D, v interface{}) error {
+	sliceValue := reflect.ValueOf(v)
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("ToArray parm must be a pointer to a slice, not %T", v)
+	}
+
+	slice := sliceValue.Elem()
+	slice.Set(slice.Slice(0, 0))
+
+	for _, doc := range docs {
+		elem := reflect.New(slice.Type().Elem())
+		if err := decodeDoc(doc, elem.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+
+	return nil
+}
+
+// Count returns a count of the documents for the cursor then closes the cursor.
+// If no documents have been read, the count is done by the server,
+// honoring any Skip() and Limit(), without reading the documents.
+// Otherwise the remaining documents are read and counted.
 func (c *Cursor) Count() int {
 	if !c.requireOpenCursor() {
 		return 0
 	}
-	return len(c.ToArray())
+
+	if c.MongoCursor != nil {
+		return len(c.remainingDocs())
+	}
+
+	count, err := c.countDocuments()
+	c.Close()
+	c.setErr(err)
+
+	return int(count)
+}
+
+// Size returns a count of the documents for the cursor, honoring any
+// Skip() and Limit(), similar to the MongoDB Shell cursor.size().
+// Unlike Count(), Size() does not close the cursor.
+func (c *Cursor) Size() int {
+	if !c.requireOpenCursor() {
+		return 0
+	}
+
+	count, err := c.countDocuments()
+	c.setErr(err)
+
+	return int(count)
+}
+
+// countDocuments has the server count the documents for a cursor.
+// For a Find() cursor uses countDocuments with the cursor Filter, Skip and Limit.
+// For an Aggregate() cursor runs the pipeline with a $count stage added.
+func (c *Cursor) countDocuments() (int64, error) {
+	if c.IsFindCursor {
+		countOpts := options.Count()
+		countOpts.Skip = c.FindOptions.Skip
+		countOpts.Collation = c.FindOptions.Collation
+		countOpts.Hint = c.FindOptions.Hint
+		countOpts.MaxTime = c.FindOptions.MaxTime
+
+		// a negative limit means a single batch for a find
+		if c.FindOptions.Limit != nil && *c.FindOptions.Limit != 0 {
+			limit := *c.FindOptions.Limit
+			if limit < 0 {
+				limit = -limit
+			}
+			countOpts.SetLimit(limit)
+		}
+
+		return c.Collection.MongoColl.CountDocuments(context.Background(), c.Filter, countOpts)
+	}
+
+	return c.aggregateCount(c.pipeline())
+}
+
+// aggregateCount returns the number of documents output by a pipeline,
+// using the cursor's aggregate options.
+// A pipeline ending with $out or $merge can't be counted without writing its output.
+func (c *Cursor) aggregateCount(pipeline bson.A) (int64, error) {
+	if len(pipeline) > 0 && isOutputStage(pipeline[len(pipeline)-1]) {
+		return 0, ErrOutputPipeline
+	}
+
+	pipeline = appendStages(pipeline, bson.D{{Key: "$count", Value: "count"}})
+	mongoCursor, err := c.Collection.MongoColl.Aggregate(context.Background(), pipeline, &c.AggrOptions)
+	if err != nil {
+		return 0, err
+	}
+
+	result := []struct {
+		Count int64 `bson:"count"`
+	}{}
+	err = mongoCursor.All(context.Background(), &result)
+	if err != nil || len(result) == 0 {
+		return 0, err
+	}
+
+	return result[0].Count, nil
+}
+
+// appendStages returns a new pipeline with stages added
+// to the end of an aggregation pipeline which may be a bson.A or []bson.D.
+// Since $out and $merge must be the last stage, the stages are
+// added before a final $out or $merge.
+func appendStages(pipeline interface{}, stages ...bson.D) bson.A {
+	result := bson.A{}
+
+	switch p := pipeline.(type) {
+	case bson.A:
+		result = append(result, p...)
+	case []bson.D:
+		for _, stage := range p {
+			result = append(result, stage)
+		}
+	}
+
+	output := bson.A{}
+	if last := len(result) - 1; last >= 0 && isOutputStage(result[last]) {
+		output = append(output, result[last])
+		result = result[:last]
+	}
+
+	for _, stage := range stages {
+		result = append(result, stage)
+	}
+
+	return append(result, output...)
+}
+
+// isOutputStage returns true if stage is an $out or $merge stage
+func isOutputStage(stage interface{}) bool {
+	switch s := stage.(type) {
+	case bson.D:
+		return len(s) == 1 && (s[0].Key == "$out" || s[0].Key == "$merge")
+	case bson.M:
+		_, out := s["$out"]
+		_, merge := s["$merge"]
+		return len(s) == 1 && (out || merge)
+	}
+
+	return false
 }
 
 // Pretty returns a pretty string version of the remaining documents for a cursor.
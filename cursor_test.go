@@ -1,6 +1,8 @@
 package mongolang
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -36,6 +38,67 @@ func TestCount(t *testing.T) {
 		t.Errorf("TestCount had %d instead of 1516 as count", count)
 	}
 
+	// Count honors skip and limit
+	count = db.Coll("zips").
+		Find(`{"state":"CA"}`).Skip(1510).Limit(10).Count()
+
+	if count != 6 {
+		t.Errorf("TestCount with skip and limit had %d instead of 6 as count", count)
+	}
+
+	// Size leaves the cursor open
+	cursor := db.Coll("zips").Find(`{"state":"CA"}`).Limit(10)
+	size := cursor.Size()
+	if size != 10 || cursor.IsClosed {
+		t.Errorf("TestCount Size() returned %d, IsClosed: %v", size, cursor.IsClosed)
+	}
+
+	if len(cursor.ToArray()) != 10 {
+		t.Error("TestCount unable to read documents after Size()")
+	}
+
+	// aggregate count
+	count = db.Coll("zips").Aggregate(`[{"$match":{"state":"CA"}}]`).Count()
+	if count != 1516 {
+		t.Errorf("TestCount aggregate had %d instead of 1516 as count", count)
+	}
+
+	count = db.Coll("zips").Aggregate(`[{"$match":{"state":"none"}}]`).Count()
+	if count != 0 || db.Err != nil {
+		t.Errorf("TestCount aggregate had %d instead of 0 as count, error: %v", count, db.Err)
+	}
+}
+
+func TestAppendStages(t *testing.T) {
+	limit := bson.D{{Key: "$limit", Value: 1}}
+	match := bson.D{{Key: "$match", Value: bson.D{}}}
+
+	pipeline := appendStages([]bson.D{match}, limit)
+	if len(pipeline) != 2 || pipeline[1].(bson.D)[0].Key != "$limit" {
+		t.Errorf("appendStages to []bson.D returned %v", pipeline)
+	}
+
+	original := bson.A{match}
+	pipeline = appendStages(original, limit)
+	if len(pipeline) != 2 || len(original) != 1 {
+		t.Errorf("appendStages to bson.A returned %v, original %v", pipeline, original)
+	}
+
+	out := bson.D{{Key: "$out", Value: "coll"}}
+	pipeline = appendStages(bson.A{match, out}, limit)
+	if len(pipeline) != 3 || pipeline[1].(bson.D)[0].Key != "$limit" || pipeline[2].(bson.D)[0].Key != "$out" {
+		t.Errorf("appendStages before $out returned %v", pipeline)
+	}
+
+	pipeline = appendStages([]bson.D{{{Key: "$merge", Value: "coll"}}}, limit)
+	if len(pipeline) != 2 || pipeline[0].(bson.D)[0].Key != "$limit" {
+		t.Errorf("appendStages before $merge returned %v", pipeline)
+	}
+
+	pipeline = appendStages(nil, limit)
+	if len(pipeline) != 1 {
+		t.Errorf("appendStages to nil returned %v", pipeline)
+	}
 }
 
 func TestString(t *testing.T) {
@@ -95,6 +158,7 @@ func TestCursorErr(t *testing.T) {
 	cursor.ToArray()
 	cursor.Next()
 	cursor.Count()
+	cursor.Size()
 	s := cursor.String()
 	if cursor.Err() != ErrClosedCursor {
 		t.Errorf("expected ErrClosedCursor got %v, String(): %s", cursor.Err(), s)
@@ -118,3 +182,414 @@ func TestCursorErr(t *testing.T) {
 		t.Error("expected error from invalid Next() call")
 	}
 }
+
+func TestForEach(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	// includes the document buffered by HasNext
+	cursor := db.Coll("zips").Find(`{"state":"CA"}`)
+	cursor.HasNext()
+
+	count := 0
+	cursor.ForEach(func(doc *bson.D) {
+		count++
+	})
+
+	if count != 1516 || !cursor.IsClosed || db.Err != nil {
+		t.Errorf("TestForEach had %d instead of 1516 documents, closed: %v, error: %v", count, cursor.IsClosed, db.Err)
+	}
+
+	// stop early
+	count = 0
+	cursor = db.Coll("zips").Find(`{"state":"CA"}`)
+	cursor.ForEachWhile(func(doc *bson.D) (bool, error) {
+		count++
+		return count < 10, nil
+	})
+
+	if count != 10 || !cursor.IsClosed || db.Err != nil {
+		t.Errorf("TestForEach stopped after %d instead of 10 documents, error: %v", count, db.Err)
+	}
+
+	// stop with an error
+	stopErr := errors.New("stop")
+	cursor = db.Coll("zips").Find(`{"state":"CA"}`)
+	cursor.ForEachWhile(func(doc *bson.D) (bool, error) {
+		return true, stopErr
+	})
+
+	if cursor.Err() != stopErr || !cursor.IsClosed {
+		t.Errorf("TestForEach expected error %v, got %v", stopErr, cursor.Err())
+	}
+}
+
+func TestDecodeFunc(t *testing.T) {
+	type zip struct{ City string }
+
+	_, docType, err := decodeFunc(func(z *zip) {})
+	if err != nil || docType.Name() != "zip" {
+		t.Errorf("decodeFunc returned %v, error: %v", docType, err)
+	}
+
+	invalid := []interface{}{nil, "f", func(z zip) {}, func(z *zip) bool { return true }, func(a, b *zip) {}}
+	for _, f := range invalid {
+		if _, _, err = decodeFunc(f); err == nil {
+			t.Errorf("expected error for %T", f)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	type zip struct {
+		ID    string `bson:"_id"`
+		City  string
+		State string
+		Pop   int
+	}
+
+	var z zip
+	db.Coll("zips").FindOne(`{"_id":"90650"}`, `{"loc":0}`, &z)
+	if db.Err != nil || z.City != "NORWALK" || z.State != "CA" {
+		t.Errorf("TestDecode FindOne decoded %+v, error: %v", z, db.Err)
+	}
+
+	cursor := db.Coll("zips").Find(`{"state":"CA"}`).Sort(`{"pop":-1}`)
+	z = zip{}
+	cursor.Next(&z)
+	if db.Err != nil || z.Pop == 0 {
+		t.Errorf("TestDecode Next decoded %+v, error: %v", z, db.Err)
+	}
+	cursor.Close()
+
+	count := 0
+	db.Coll("zips").Find(`{"state":"CA"}`).ForEachDecode(func(z *zip) {
+		if z.State == "CA" {
+			count++
+		}
+	})
+
+	if count != 1516 || db.Err != nil {
+		t.Errorf("TestDecode ForEachDecode decoded %d instead of 1516 documents, error: %v", count, db.Err)
+	}
+}
+
+// testZips returns n documents for the stand-in server
+func testZips(n int) []bson.D {
+	docs := []bson.D{}
+	for i := 1; i <= n; i++ {
+		state := "CA"
+		if i%2 == 0 {
+			state = "NV"
+		}
+		docs = append(docs, bson.D{{Key: "_id", Value: int32(i)}, {Key: "state", Value: state}})
+	}
+
+	return docs
+}
+
+// testIDs returns the _id of each document
+func testIDs(docs []bson.D) []int32 {
+	ids := []int32{}
+	for _, doc := range docs {
+		id, _ := lookup(doc, "_id").(int32)
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func TestCursorStates(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(10)})
+	defer server.close()
+	defer db.Disconnect()
+
+	// batches of 3 documents so reading crosses getMore calls
+	find := func() *Cursor {
+		c := db.Coll("zips").Find()
+		c.FindOptions.SetBatchSize(3)
+		return c
+	}
+
+	// HasNext buffers a document which Next then returns
+	c := find()
+	if !c.HasNext() || !c.HasNext() || c.NextDoc == nil {
+		t.Fatalf("HasNext() didn't buffer a document, error: %v", db.Err)
+	}
+
+	if id := lookup(*c.Next(), "_id"); id != int32(1) || c.NextDoc != nil {
+		t.Errorf("Next() returned _id %v instead of the buffered document", id)
+	}
+
+	// ToArray includes the buffered document and excludes consumed ones
+	c.Next()
+	c.HasNext()
+	ids := testIDs(c.ToArray())
+	if len(ids) != 8 || ids[0] != 3 || ids[7] != 10 || !c.IsClosed || db.Err != nil {
+		t.Errorf("ToArray() returned %v, closed: %v, error: %v", ids, c.IsClosed, db.Err)
+	}
+
+	// HasNext on a closed cursor returns false without an error,
+	// other methods set ErrClosedCursor
+	if c.HasNext() || db.Err != nil {
+		t.Errorf("HasNext() on closed cursor returned true or error %v", db.Err)
+	}
+
+	c.Next()
+	if db.Err != ErrClosedCursor {
+		t.Errorf("expected ErrClosedCursor from Next(), got %v", db.Err)
+	}
+
+	// reading to the end closes the cursor
+	c = find()
+	n := 0
+	for c.HasNext() {
+		c.Next()
+		n++
+	}
+	if n != 10 || !c.IsClosed || db.Err != nil {
+		t.Errorf("HasNext()/Next() read %d documents, closed: %v, error: %v", n, c.IsClosed, db.Err)
+	}
+
+	// Count before reading is done by the server
+	db.Err = nil
+	if count := find().Skip(1).Limit(5).Count(); count != 5 || db.Err != nil {
+		t.Errorf("Count() returned %d, error: %v", count, db.Err)
+	}
+
+	// Count after reading counts the remaining documents including a buffered one
+	c = find()
+	c.Next()
+	c.Next()
+	c.HasNext()
+	if count := c.Count(); count != 8 || !c.IsClosed || db.Err != nil {
+		t.Errorf("Count() after reading returned %d, error: %v", count, db.Err)
+	}
+
+	// ForEach includes the buffered document
+	c = find()
+	c.Next()
+	c.HasNext()
+	ids = []int32{}
+	c.ForEach(func(doc *bson.D) {
+		ids = append(ids, lookup(*doc, "_id").(int32))
+	})
+	if len(ids) != 9 || ids[0] != 2 || !c.IsClosed {
+		t.Errorf("ForEach() read %v, closed: %v", ids, c.IsClosed)
+	}
+
+	// Pretty includes the buffered document and excludes consumed ones
+	c = find().Limit(3)
+	c.Next()
+	c.HasNext()
+	pretty := c.Pretty()
+	if strings.Contains(pretty, "_id : 1 ") || !strings.Contains(pretty, "_id : 2 ") || !strings.Contains(pretty, "_id : 3 ") {
+		t.Errorf("Pretty() returned:\n%s", pretty)
+	}
+
+	// options can't change once reading has started
+	c = find()
+	c.HasNext()
+	c.Limit(2)
+	if db.Err != ErrCursorStarted {
+		t.Errorf("expected ErrCursorStarted from Limit(), got %v", db.Err)
+	}
+	c.Close()
+
+	// Close discards any remaining documents and kills the server cursor
+	db.Err = nil
+	killed := server.commandCount("killCursors")
+	c = find()
+	c.HasNext()
+	if server.openCursors() != 1 {
+		t.Errorf("expected 1 open server cursor, have %d", server.openCursors())
+	}
+	if err := c.Close(); err != nil || server.openCursors() != 0 || server.commandCount("killCursors") != killed+1 {
+		t.Errorf("Close() returned %v with %d server cursors open", err, server.openCursors())
+	}
+	if err := c.Close(); err != ErrClosedCursor {
+		t.Errorf("expected ErrClosedCursor closing twice, got %v", err)
+	}
+}
+
+func TestCursorDecodeStates(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(5)})
+	defer server.close()
+	defer db.Disconnect()
+
+	type zip struct {
+		ID    int32 `bson:"_id"`
+		State string
+	}
+
+	// ToArray into a custom slice includes the buffered document
+	c := db.Coll("zips").Find(`{"state":"CA"}`)
+	c.Next()
+	c.HasNext()
+	zips := []zip{{ID: 99}}
+	c.ToArray(&zips)
+	if len(zips) != 2 || zips[0].ID != 3 || zips[1].ID != 5 || db.Err != nil {
+		t.Errorf("ToArray(&zips) returned %+v, error: %v", zips, db.Err)
+	}
+
+	// aggregate cursors follow the same rules
+	c = db.Coll("zips").Aggregate(`[{"$match":{"state":"NV"}}]`)
+	var z zip
+	c.Next(&z)
+	if z.ID != 2 || c.Count() != 1 || db.Err != nil {
+		t.Errorf("aggregate Next(&z) decoded %+v, error: %v", z, db.Err)
+	}
+
+	if count := db.Coll("zips").Aggregate(`[{"$match":{"state":"NV"}}]`).Count(); count != 2 || db.Err != nil {
+		t.Errorf("aggregate Count() returned %d, error: %v", count, db.Err)
+	}
+}
+
+func TestFindModifiers(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(5)})
+	defer server.close()
+	defer db.Disconnect()
+
+	db.Coll("zips").Find(`{"state":"CA"}`).
+		Projection(`{"state":1}`).
+		BatchSize(2).
+		MaxTimeMS(500).
+		Hint(`{"state":1}`).
+		Collation(`{"locale":"en","strength":2}`).
+		Comment("test").
+		Min(`{"state":"A"}`).
+		Max(`{"state":"Z"}`).
+		ReturnKey(false).
+		ShowRecordID().
+		NoCursorTimeout().
+		AllowPartialResults().
+		AllowDiskUse().
+		ToArray()
+
+	if db.Err != nil {
+		t.Fatalf("TestFindModifiers error: %v", db.Err)
+	}
+
+	cmd := server.lastCommand("find")
+	expected := map[string]string{
+		"projection":          `{"state":1}`,
+		"batchSize":           "2",
+		"maxTimeMS":           "500",
+		"hint":                `{"state":1}`,
+		"collation":           `{"locale":"en","strength":2}`,
+		"comment":             "test",
+		"min":                 `{"state":"A"}`,
+		"max":                 `{"state":"Z"}`,
+		"returnKey":           "false",
+		"showRecordId":        "true",
+		"noCursorTimeout":     "true",
+		"allowPartialResults": "true",
+		"allowDiskUse":        "true",
+	}
+
+	for key, value := range expected {
+		v := lookup(cmd, key)
+		s := fmt.Sprint(v)
+		if doc, ok := v.(bson.D); ok {
+			json, _ := bson.MarshalExtJSON(doc, false, false)
+			s = string(json)
+		}
+
+		if s != value {
+			t.Errorf("expected find option %s: %s, got %s", key, value, s)
+		}
+	}
+
+	// a hint can be an index name
+	db.Coll("zips").Find().Hint("state_1").ToArray()
+	if hint := lookup(server.lastCommand("find"), "hint"); hint != "state_1" {
+		t.Errorf("expected hint state_1, got %v", hint)
+	}
+
+	// some modifiers are for pending find cursors only
+	db.Coll("zips").Aggregate(`[]`).Projection(`{"state":1}`)
+	if db.Err != ErrNotFindCursor {
+		t.Errorf("expected ErrNotFindCursor, got %v", db.Err)
+	}
+
+	db.Coll("zips").Find().Collation(`{"locale":1}`)
+	if db.Err == nil {
+		t.Error("expected error for invalid collation")
+	}
+}
+
+func TestAggregateModifiers(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(5)})
+	defer server.close()
+	defer db.Disconnect()
+
+	// options parm
+	docs := db.Coll("zips").Aggregate(`[{"$match":{"state":"CA"}}]`,
+		`{"allowDiskUse":true,"cursor":{"batchSize":1},"comment":"parm","let":{"minPop":10}}`).ToArray()
+
+	cmd := server.lastCommand("aggregate")
+	if len(docs) != 3 || db.Err != nil || lookup(cmd, "allowDiskUse") != true ||
+		lookup(cmd, "cursor.batchSize") != int32(1) || lookup(cmd, "comment") != "parm" ||
+		lookup(cmd, "let.minPop") != int32(10) {
+		t.Errorf("aggregate options not sent, error: %v, command: %v", db.Err, cmd)
+	}
+
+	// chained
+	db.Coll("zips").Aggregate(`[{"$match":{"state":"CA"}}]`).
+		BatchSize(2).
+		MaxTimeMS(500).
+		Hint("state_1").
+		Collation(`{"locale":"en"}`).
+		Comment("chained").
+		Let(`{"minPop":20}`).
+		AllowDiskUse(false).
+		ToArray()
+
+	cmd = server.lastCommand("aggregate")
+	if db.Err != nil || lookup(cmd, "cursor.batchSize") != int32(2) || lookup(cmd, "maxTimeMS") != int64(500) ||
+		lookup(cmd, "hint") != "state_1" || lookup(cmd, "collation.locale") != "en" ||
+		lookup(cmd, "comment") != "chained" || lookup(cmd, "let.minPop") != int32(20) ||
+		lookup(cmd, "allowDiskUse") != false {
+		t.Errorf("chained aggregate options not sent, error: %v, command: %v", db.Err, cmd)
+	}
+
+	db.Coll("zips").Aggregate(`[]`, `{"explain":true}`)
+	if db.Err == nil {
+		t.Error("expected error for unsupported aggregate option")
+	}
+}
+
+func TestAggregateSortSkipLimit(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(10)})
+	defer server.close()
+	defer db.Disconnect()
+
+	// same results for find and aggregate whatever order the methods are called in
+	find := testIDs(db.Coll("zips").Find(`{"state":"CA"}`).Limit(2).Skip(1).Sort(`{"_id":-1}`).ToArray())
+	aggr := testIDs(db.Coll("zips").Aggregate(`[{"$match":{"state":"CA"}}]`).Limit(2).Skip(1).Sort(`{"_id":-1}`).ToArray())
+
+	if db.Err != nil || fmt.Sprint(find) != "[7 5]" || fmt.Sprint(aggr) != fmt.Sprint(find) {
+		t.Errorf("expected [7 5] for find %v and aggregate %v, error: %v", find, aggr, db.Err)
+	}
+
+	pipeline, _ := bson.MarshalExtJSON(bson.D{{Key: "p", Value: lookup(server.lastCommand("aggregate"), "pipeline")}}, false, false)
+	expected := `{"p":[{"$match":{"state":"CA"}},{"$sort":{"_id":-1}},{"$skip":1},{"$limit":2}]}`
+	if string(pipeline) != expected {
+		t.Errorf("expected pipeline %s, got %s", expected, pipeline)
+	}
+
+	// count honors skip and limit
+	if count := db.Coll("zips").Aggregate(`[]`).Skip(8).Limit(5).Count(); count != 2 || db.Err != nil {
+		t.Errorf("expected aggregate count of 2, got %d, error: %v", count, db.Err)
+	}
+
+	// a limit of 0 is no limit
+	if docs := db.Coll("zips").Aggregate(`[]`).Limit(0).ToArray(); len(docs) != 10 {
+		t.Errorf("expected 10 documents with no limit, got %d", len(docs))
+	}
+}
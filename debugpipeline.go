@@ -0,0 +1,128 @@
+package mongolang
+
+/*
+	Stage by stage debugging of an aggregation pipeline, to find the stage
+	where documents disappear when a pipeline returns nothing:
+
+		db.Coll("zips").Aggregate(pipeline).DebugPipeline(2).Print()
+
+	The collection is counted first, then each prefix of the pipeline is run,
+	the first stage, the first two stages and so on, counting the documents
+	output and returning up to n of them as samples. Stages added by Sort(),
+	Skip() and Limit() are included. $out and $merge stages are not run.
+*/
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StageDebug is the result of running a pipeline up to and including Stage.
+// Stage is nil for the documents input to the pipeline.
+// Skipped is true for $out and $merge stages, which are not run.
+type StageDebug struct {
+	Stage   bson.D
+	Count   int64
+	Samples []bson.D
+	Skipped bool
+	Err     error
+}
+
+// PipelineDebug has the result for each stage of a pipeline
+type PipelineDebug []StageDebug
+
+// DebugPipeline runs each prefix of an Aggregate() cursor's pipeline and reports
+// the number of documents output by each stage, with up to n sample documents.
+// The cursor is not read and remains open.
+// If a stage fails the results up to and including that stage are returned.
+func (c *Cursor) DebugPipeline(n int) PipelineDebug {
+	if !c.requireOpenAggregateCursor() {
+		return PipelineDebug{}
+	}
+
+	result := PipelineDebug{c.debugStage(nil, bson.A{}, n)}
+	if result[0].Err != nil {
+		c.setErr(result[0].Err)
+		return result
+	}
+
+	prefix := bson.A{}
+
+	for _, stage := range c.pipeline() {
+		stageDoc, _ := stage.(bson.D)
+
+		if isOutputStage(stageDoc) {
+			result = append(result, StageDebug{Stage: stageDoc, Skipped: true})
+			continue
+		}
+
+		prefix = append(prefix, stageDoc)
+		result = append(result, c.debugStage(stageDoc, prefix, n))
+		if err := result[len(result)-1].Err; err != nil {
+			c.setErr(err)
+			break
+		}
+	}
+
+	return result
+}
+
+// debugStage counts and samples the documents output by a pipeline ending with stage
+func (c *Cursor) debugStage(stage bson.D, pipeline bson.A, n int) StageDebug {
+	result := StageDebug{Stage: stage, Samples: []bson.D{}}
+
+	result.Count, result.Err = c.aggregateCount(pipeline)
+	if result.Err != nil || result.Count == 0 || n <= 0 {
+		return result
+	}
+
+	sample := appendStages(pipeline, bson.D{{Key: "$limit", Value: int64(n)}})
+	mongoCursor, err := c.Collection.MongoColl.Aggregate(context.Background(), sample, &c.AggrOptions)
+	if err == nil {
+		err = mongoCursor.All(context.Background(), &result.Samples)
+	}
+	result.Err = err
+
+	return result
+}
+
+// String returns each stage with its count and sample documents
+// in MongoDB Shell syntax. The first stage to output no documents is marked.
+func (d PipelineDebug) String() string {
+	var buf bytes.Buffer
+
+	marked := false
+	for i, stage := range d {
+		if stage.Stage == nil {
+			buf.WriteString("input\n")
+		} else {
+			fmt.Fprintf(&buf, "stage %d %s\n", i, ShellJSON(stage.Stage))
+		}
+
+		switch {
+		case stage.Err != nil:
+			fmt.Fprintf(&buf, "   error: %v\n", stage.Err)
+		case stage.Skipped:
+			buf.WriteString("   not run\n")
+		case stage.Count == 0 && !marked:
+			buf.WriteString("   count: 0 <-- no documents output\n")
+			marked = true
+		default:
+			fmt.Fprintf(&buf, "   count: %d\n", stage.Count)
+		}
+
+		for _, doc := range stage.Samples {
+			fmt.Fprintf(&buf, "   %s\n", ShellJSON(doc))
+		}
+	}
+
+	return buf.String()
+}
+
+// Print prints the PipelineDebug
+func (d PipelineDebug) Print() {
+	fmt.Print(d.String())
+}
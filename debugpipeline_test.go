@@ -0,0 +1,74 @@
+package mongolang
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDebugPipeline(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(5)})
+	defer server.close()
+	defer db.Disconnect()
+
+	zips := db.Coll("zips")
+
+	cursor := zips.Aggregate(`[{"$match":{"state":"CA"}},{"$match":{"state":"NV"}},{"$out":"empty"}]`).Limit(1)
+	debug := cursor.DebugPipeline(2)
+
+	if db.Err != nil || len(debug) != 5 {
+		t.Fatalf("expected input and 4 stages, got %d, error %v", len(debug), db.Err)
+	}
+
+	counts := []int64{5, 3, 0, 0, 0}
+	samples := []int{2, 2, 0, 0, 0}
+	for i, stage := range debug {
+		if stage.Count != counts[i] || len(stage.Samples) != samples[i] {
+			t.Errorf("stage %d: expected count %d with %d samples, got %d with %d",
+				i, counts[i], samples[i], stage.Count, len(stage.Samples))
+		}
+	}
+
+	if debug[3].Stage[0].Key != "$limit" || !debug[4].Skipped {
+		t.Errorf("expected the Limit() stage to be run before $out, and $out to be skipped")
+	}
+
+	if server.commandCount("getMore") != 0 || cursor.IsClosed || cursor.MongoCursor != nil {
+		t.Errorf("expected the cursor not to be read")
+	}
+
+	expected := `input
+   count: 5
+   { _id: 1, state: "CA" }
+   { _id: 2, state: "NV" }
+stage 1 { $match: { state: "CA" } }
+   count: 3
+   { _id: 1, state: "CA" }
+   { _id: 3, state: "CA" }
+stage 2 { $match: { state: "NV" } }
+   count: 0 <-- no documents output
+stage 3 { $limit: 1 }
+   count: 0
+stage 4 { $out: "empty" }
+   not run
+`
+	if debug.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, debug.String())
+	}
+
+	// a pipeline ending with $out can't be counted without running the $out
+	if n := zips.Aggregate(`[{"$match":{}},{"$out":"empty"}]`).Count(); n != 0 || db.Err != ErrOutputPipeline {
+		t.Errorf("expected ErrOutputPipeline, got %d, error %v", n, db.Err)
+	}
+
+	// a failed stage ends the report
+	debug = zips.Aggregate(`[{"$unsupported":{}},{"$match":{}}]`).DebugPipeline(1)
+	if db.Err == nil || len(debug) != 2 || debug[1].Err == nil {
+		t.Errorf("expected an error for the first stage, got %v", db.Err)
+	}
+
+	zips.Find().DebugPipeline(1)
+	if db.Err != ErrNotAggregateCursor {
+		t.Errorf("expected ErrNotAggregateCursor, got %v", db.Err)
+	}
+}
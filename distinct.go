@@ -0,0 +1,214 @@
+package mongolang
+
+/*
+	Methods to answer the question "what values does this field take?"
+
+		db.Coll("zips").Distinct("state", `{"pop":{"$gt":50000}}`)
+		db.Coll("zips").DistinctCounts("city", `{"state":"CA"}`).Print()
+*/
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ValueCount is a distinct value for a field and
+// the number of documents with that value.
+type ValueCount struct {
+	Value interface{} `bson:"_id"`
+	Count int64       `bson:"count"`
+}
+
+// ValueCounts is a list of distinct values, sorted by count
+type ValueCounts []ValueCount
+
+// Distinct returns the distinct values for a field.
+// Parms are optional. If present, the following parms
+// are recognized:
+//
+//	parms[0] - query - bson.M or bson.D defines of which documents to select
+//	parms[1] - options - JSON string, bson.D or bson.M with collation or maxTimeMS
+func (c *Coll) Distinct(field string, parms ...interface{}) []interface{} {
+	result := []interface{}{}
+
+	if !c.collOkay() {
+		return result
+	}
+
+	c.resetErrors()
+
+	filter, err := c.distinctFilter(parms)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	distinctOpts, err := distinctOptions(parms)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	values, err := c.MongoColl.Distinct(context.Background(), field, filter, distinctOpts)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	return values
+}
+
+// DistinctCounts returns the distinct values for a field along with the
+// number of documents with each value, sorted by count, largest first.
+// As with Distinct(), each element of an array field is counted separately
+// and documents without the field are not counted.
+// Parms are the same as for Distinct().
+func (c *Coll) DistinctCounts(field string, parms ...interface{}) ValueCounts {
+	result := ValueCounts{}
+
+	if !c.collOkay() {
+		return result
+	}
+
+	c.resetErrors()
+
+	filter, err := c.distinctFilter(parms)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	distinctOpts, err := distinctOptions(parms)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	fieldPath := "$" + strings.TrimPrefix(field, "$")
+	pipeline := []bson.D{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$unwind", Value: fieldPath}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: fieldPath}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	aggrOpts := options.Aggregate()
+	aggrOpts.Collation = distinctOpts.Collation
+	aggrOpts.MaxTime = distinctOpts.MaxTime
+
+	cursor, err := c.MongoColl.Aggregate(context.Background(), pipeline, aggrOpts)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	c.DB.Err = cursor.All(context.Background(), &result)
+	return result
+}
+
+// distinctFilter returns the optional filter parm
+func (c *Coll) distinctFilter(parms []interface{}) (interface{}, error) {
+	if len(parms) == 0 {
+		return bson.D{}, nil
+	}
+
+	return c.verifyLinted(parms[0], bsonDAllowed|bsonMAllowed, LintFilter)
+}
+
+// distinctOptions converts the optional options parm for
+// Distinct() and DistinctCounts() to an options.DistinctOptions
+func distinctOptions(parms []interface{}) (*options.DistinctOptions, error) {
+	result := options.Distinct()
+	if len(parms) < 2 {
+		return result, nil
+	}
+
+	doc, err := optionsParm(parms[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range doc {
+		var d time.Duration
+		switch e.Key {
+		case "collation":
+			result.Collation, err = optCollation(e)
+		case "maxTimeMS":
+			d, err = optMaxTime(e)
+			result.SetMaxTime(d)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Values returns just the values from the ValueCounts
+func (vc ValueCounts) Values() []interface{} {
+	result := make([]interface{}, len(vc))
+	for i, v := range vc {
+		result[i] = v.Value
+	}
+
+	return result
+}
+
+// String returns the ValueCounts formatted as a table
+// with one row per value and a total at the end.
+func (vc ValueCounts) String() string {
+	values := make([]string, len(vc))
+	counts := make([]string, len(vc))
+
+	var total int64
+	valueWidth, countWidth := len("value"), len("count")
+
+	for i, v := range vc {
+		values[i] = fmt.Sprintf("%v", v.Value)
+		if v.Value == nil {
+			values[i] = "null"
+		}
+		counts[i] = fmt.Sprintf("%d", v.Count)
+		total += v.Count
+
+		if len(values[i]) > valueWidth {
+			valueWidth = len(values[i])
+		}
+		if len(counts[i]) > countWidth {
+			countWidth = len(counts[i])
+		}
+	}
+
+	totalString := fmt.Sprintf("%d", total)
+	if len(totalString) > countWidth {
+		countWidth = len(totalString)
+	}
+
+	var buf bytes.Buffer
+	line := strings.Repeat("-", valueWidth) + "  " + strings.Repeat("-", countWidth) + "\n"
+
+	fmt.Fprintf(&buf, "%-*s  %*s\n", valueWidth, "value", countWidth, "count")
+	buf.WriteString(line)
+	for i := range vc {
+		fmt.Fprintf(&buf, "%-*s  %*s\n", valueWidth, values[i], countWidth, counts[i])
+	}
+	buf.WriteString(line)
+	fmt.Fprintf(&buf, "%-*s  %*s\n", valueWidth, fmt.Sprintf("%d values", len(vc)), countWidth, totalString)
+
+	return buf.String()
+}
+
+// Print prints the ValueCounts as a table
+func (vc ValueCounts) Print() {
+	fmt.Print(vc.String())
+}
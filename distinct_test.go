@@ -0,0 +1,69 @@
+package mongolang
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func ExampleValueCounts_Print() {
+	vc := ValueCounts{
+		{Value: "LOS ANGELES", Count: 56},
+		{Value: "SAN DIEGO", Count: 32},
+		{Value: nil, Count: 1},
+	}
+
+	vc.Print()
+
+	// output:
+	// value        count
+	// -----------  -----
+	// LOS ANGELES     56
+	// SAN DIEGO       32
+	// null             1
+	// -----------  -----
+	// 3 values        89
+}
+
+func TestDistinct(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	states := db.Coll("zips").Distinct("state")
+	if db.Err != nil || len(states) != 51 {
+		t.Errorf("expected 51 states, got %d, error: %v", len(states), db.Err)
+	}
+
+	cities := db.Coll("zips").Distinct("city", `{"state":"CA"}`, `{"maxTimeMS":10000}`)
+	if db.Err != nil || len(cities) == 0 {
+		t.Errorf("expected CA cities, got %d, error: %v", len(cities), db.Err)
+	}
+
+	counts := db.Coll("zips").DistinctCounts("city", `{"state":"CA"}`)
+	if db.Err != nil || len(counts) != len(cities) {
+		t.Errorf("expected %d CA city counts, got %d, error: %v", len(cities), len(counts), db.Err)
+	}
+
+	var total int64
+	for i, vc := range counts {
+		total += vc.Count
+		if i > 0 && vc.Count > counts[i-1].Count {
+			t.Errorf("counts not sorted, %v after %v", vc, counts[i-1])
+		}
+	}
+
+	if total != 1516 {
+		t.Errorf("expected total count of 1516, got %d", total)
+	}
+
+	db.Coll("zips").Distinct("city", `{"state":"CA"}`, `{"maxTime":10000}`)
+	if db.Err == nil {
+		t.Error("Distinct with invalid option expected error")
+	}
+
+	db.Coll("zips").DistinctCounts("city", bson.A{})
+	if db.Err == nil {
+		t.Error("DistinctCounts with invalid filter expected error")
+	}
+}
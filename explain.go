@@ -0,0 +1,382 @@
+package mongolang
+
+/*
+	Methods to run the explain command and summarize the query plan it returns.
+
+		db.Coll("zips").Find(`{"state":"CA"}`).Sort(`{"pop":-1}`).Explain("executionStats")
+		db.Coll("zips").Aggregate(pipeline).Explain()
+		db.Coll("zips").ExplainCount(`{"state":"CA"}`)
+		db.Coll("zips").ExplainDelete(`{"state":"XX"}`)
+
+	The verbosity is optional and defaults to "queryPlanner", the same as the
+	MongoDB Shell. Execution statistics, such as the number of documents examined,
+	require a verbosity of "executionStats" or "allPlansExecution".
+	Explain does not modify any documents, even for ExplainDelete.
+*/
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Explain verbosity modes
+const (
+	QueryPlanner      = "queryPlanner"
+	ExecutionStats    = "executionStats"
+	AllPlansExecution = "allPlansExecution"
+)
+
+// ExplainSummary summarizes the output of the explain command.
+// Stages is the winning plan as an indented tree, one stage per line.
+// The execution statistics are only available if the explain
+// verbosity was executionStats or allPlansExecution.
+type ExplainSummary struct {
+	Stages      string
+	IndexesUsed []string
+	CollScan    bool
+
+	NReturned           int64
+	KeysExamined        int64
+	DocsExamined        int64
+	ExecutionTimeMillis int64
+}
+
+// Explanation is the result of an explain.
+// Raw is the complete output of the explain command.
+type Explanation struct {
+	Raw     bson.D
+	Summary ExplainSummary
+}
+
+// Explain runs the explain command for the cursor's Find() or Aggregate()
+// returning both the raw query plan and a summary of it.
+// The cursor is not read and remains open.
+func (c *Cursor) Explain(verbosity ...string) *Explanation {
+	if !c.requireOpenCursor() {
+		return &Explanation{}
+	}
+
+	var cmd bson.D
+	if c.IsFindCursor {
+		cmd = c.findCommand()
+	} else {
+		cmd = c.aggregateCommand()
+	}
+
+	return c.Collection.explain(cmd, verbosity)
+}
+
+// ExplainCount explains counting the documents that match the filter.
+func (c *Coll) ExplainCount(filter interface{}, verbosity ...string) *Explanation {
+	if !c.collOkay() {
+		return &Explanation{}
+	}
+
+	c.resetErrors()
+
+	countFilter, err := verifyParm(filter, bsonDAllowed|bsonMAllowed)
+	c.DB.Err = err
+	if err != nil {
+		return &Explanation{}
+	}
+
+	cmd := bson.D{{Key: "count", Value: c.CollName}, {Key: "query", Value: countFilter}}
+	return c.explain(cmd, verbosity)
+}
+
+// ExplainDelete explains deleting all of the documents that match the filter,
+// as for DeleteMany(). No documents are deleted.
+func (c *Coll) ExplainDelete(filter interface{}, verbosity ...string) *Explanation {
+	if !c.collOkay() {
+		return &Explanation{}
+	}
+
+	c.resetErrors()
+
+	deleteFilter, err := verifyParm(filter, bsonDAllowed|bsonMAllowed)
+	c.DB.Err = err
+	if err != nil {
+		return &Explanation{}
+	}
+
+	deletes := bson.A{bson.D{{Key: "q", Value: deleteFilter}, {Key: "limit", Value: 0}}}
+	cmd := bson.D{{Key: "delete", Value: c.CollName}, {Key: "deletes", Value: deletes}}
+	return c.explain(cmd, verbosity)
+}
+
+// explain runs the explain command for cmd with an optional verbosity
+func (c *Coll) explain(cmd bson.D, verbosity []string) *Explanation {
+	mode := QueryPlanner
+	if len(verbosity) > 0 {
+		mode = verbosity[0]
+	}
+
+	raw, err := runExplain(c.MongoColl.Database(), cmd, mode)
+	c.DB.Err = err
+	if err != nil {
+		return &Explanation{}
+	}
+
+	return &Explanation{Raw: raw, Summary: summarizeExplain(raw)}
+}
+
+// findCommand returns the find command for a Find() cursor
+func (c *Cursor) findCommand() bson.D {
+	opts := c.FindOptions
+	cmd := bson.D{{Key: "find", Value: c.Collection.CollName}, {Key: "filter", Value: c.Filter}}
+
+	// as the driver does, a negative limit is sent as a positive limit with a single batch
+	var limit interface{} = opts.Limit
+	singleBatch := opts.Limit != nil && *opts.Limit < 0
+	if singleBatch {
+		limit = -*opts.Limit
+	}
+
+	optional := []struct {
+		key   string
+		value interface{}
+		isSet bool
+	}{
+		{"sort", opts.Sort, opts.Sort != nil},
+		{"projection", opts.Projection, opts.Projection != nil},
+		{"hint", opts.Hint, opts.Hint != nil},
+		{"skip", opts.Skip, opts.Skip != nil},
+		{"limit", limit, opts.Limit != nil},
+		{"singleBatch", true, singleBatch},
+		{"batchSize", opts.BatchSize, opts.BatchSize != nil},
+		{"comment", opts.Comment, opts.Comment != nil},
+		{"min", opts.Min, opts.Min != nil},
+		{"max", opts.Max, opts.Max != nil},
+		{"returnKey", opts.ReturnKey, opts.ReturnKey != nil},
+		{"showRecordId", opts.ShowRecordID, opts.ShowRecordID != nil},
+		{"allowDiskUse", opts.AllowDiskUse, opts.AllowDiskUse != nil},
+		{"allowPartialResults", opts.AllowPartialResults, opts.AllowPartialResults != nil},
+		{"let", opts.Let, opts.Let != nil},
+	}
+
+	for _, o := range optional {
+		if o.isSet {
+			cmd = append(cmd, bson.E{Key: o.key, Value: o.value})
+		}
+	}
+
+	if opts.Collation != nil {
+		cmd = append(cmd, bson.E{Key: "collation", Value: opts.Collation.ToDocument()})
+	}
+
+	if opts.MaxTime != nil {
+		cmd = append(cmd, bson.E{Key: "maxTimeMS", Value: opts.MaxTime.Milliseconds()})
+	}
+
+	return cmd
+}
+
+// aggregateCommand returns the aggregate command for an Aggregate() cursor
+func (c *Cursor) aggregateCommand() bson.D {
+	opts := c.AggrOptions
+	cmd := bson.D{
+		{Key: "aggregate", Value: c.Collection.CollName},
+		{Key: "pipeline", Value: c.pipeline()},
+		{Key: "cursor", Value: bson.D{}},
+	}
+
+	if opts.AllowDiskUse != nil {
+		cmd = append(cmd, bson.E{Key: "allowDiskUse", Value: opts.AllowDiskUse})
+	}
+
+	if opts.Hint != nil {
+		cmd = append(cmd, bson.E{Key: "hint", Value: opts.Hint})
+	}
+
+	if opts.Comment != nil {
+		cmd = append(cmd, bson.E{Key: "comment", Value: opts.Comment})
+	}
+
+	if opts.Let != nil {
+		cmd = append(cmd, bson.E{Key: "let", Value: opts.Let})
+	}
+
+	if opts.Collation != nil {
+		cmd = append(cmd, bson.E{Key: "collation", Value: opts.Collation.ToDocument()})
+	}
+
+	if opts.MaxTime != nil {
+		cmd = append(cmd, bson.E{Key: "maxTimeMS", Value: opts.MaxTime.Milliseconds()})
+	}
+
+	return cmd
+}
+
+// String returns the summary of the explain
+func (e *Explanation) String() string {
+	return e.Summary.String()
+}
+
+// String returns the winning plan as an indented tree
+// followed by the indexes used and execution statistics
+func (s ExplainSummary) String() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("winning plan:\n")
+	for _, line := range strings.Split(strings.TrimSuffix(s.Stages, "\n"), "\n") {
+		fmt.Fprintf(&buf, "   %s\n", line)
+	}
+
+	indexes := strings.Join(s.IndexesUsed, ", ")
+	if indexes == "" {
+		indexes = "none"
+	}
+	fmt.Fprintf(&buf, "indexes used: %s\n", indexes)
+
+	fmt.Fprintf(&buf, "returned: %d, keys examined: %d, docs examined: %d, execution time: %dms\n",
+		s.NReturned, s.KeysExamined, s.DocsExamined, s.ExecutionTimeMillis)
+
+	return buf.String()
+}
+
+// runExplain runs the explain command for cmd, such as a find
+// or aggregate command, on database, returning the raw explain output.
+func runExplain(database *mongo.Database, cmd bson.D, verbosity string) (bson.D, error) {
+	result := bson.D{}
+
+	explainCmd := bson.D{{Key: "explain", Value: cmd}, {Key: "verbosity", Value: verbosity}}
+	err := database.RunCommand(context.Background(), explainCmd).Decode(&result)
+
+	return result, err
+}
+
+// summarizeExplain creates an ExplainSummary from the raw explain output.
+func summarizeExplain(raw bson.D) ExplainSummary {
+	result := ExplainSummary{IndexesUsed: []string{}}
+
+	queryPlanner, _ := lookup(raw, "queryPlanner").(bson.D)
+	executionStats, _ := lookup(raw, "executionStats").(bson.D)
+
+	var buf bytes.Buffer
+
+	// aggregate explain output may have the query plan in the first stage
+	if stages, ok := lookup(raw, "stages").(bson.A); ok {
+		for i := len(stages) - 1; i >= 0; i-- {
+			stage, _ := stages[i].(bson.D)
+			if len(stage) == 0 {
+				continue
+			}
+
+			if stage[0].Key == "$cursor" {
+				cursor, _ := stage[0].Value.(bson.D)
+				queryPlanner, _ = lookup(cursor, "queryPlanner").(bson.D)
+				executionStats, _ = lookup(cursor, "executionStats").(bson.D)
+				continue
+			}
+
+			fmt.Fprintf(&buf, "%s%s\n", strings.Repeat("  ", len(stages)-1-i), stage[0].Key)
+		}
+
+		// indent the query plan below the pipeline stages
+		depth := strings.Count(buf.String(), "\n")
+		result.walkPlan(&buf, planRoot(lookup(queryPlanner, "winningPlan")), depth)
+	} else {
+		result.walkPlan(&buf, planRoot(lookup(queryPlanner, "winningPlan")), 0)
+	}
+
+	result.Stages = buf.String()
+
+	result.NReturned = lookupInt64(executionStats, "nReturned")
+	result.KeysExamined = lookupInt64(executionStats, "totalKeysExamined")
+	result.DocsExamined = lookupInt64(executionStats, "totalDocsExamined")
+	result.ExecutionTimeMillis = lookupInt64(executionStats, "executionTimeMillis")
+
+	return result
+}
+
+// planRoot returns the root stage of a winning plan.
+// Newer servers may nest the stages in a queryPlan field.
+func planRoot(plan interface{}) bson.D {
+	doc, _ := plan.(bson.D)
+	if queryPlan, ok := lookup(doc, "queryPlan").(bson.D); ok {
+		return queryPlan
+	}
+
+	return doc
+}
+
+// walkPlan adds a stage and its input stages to the tree in buf,
+// recording any indexes used and whether there was a collection scan.
+func (s *ExplainSummary) walkPlan(buf *bytes.Buffer, stage bson.D, depth int) {
+	if len(stage) == 0 {
+		return
+	}
+
+	name, _ := lookup(stage, "stage").(string)
+
+	// sharded clusters have a winning plan for each shard
+	if shards, ok := lookup(stage, "shards").(bson.A); ok {
+		for _, shard := range shards {
+			shardDoc, _ := shard.(bson.D)
+			fmt.Fprintf(buf, "%sshard %v\n", strings.Repeat("  ", depth), lookup(shardDoc, "shardName"))
+			s.walkPlan(buf, planRoot(lookup(shardDoc, "winningPlan")), depth+1)
+		}
+		return
+	}
+
+	line := name
+	if indexName, ok := lookup(stage, "indexName").(string); ok {
+		line += " (" + indexName + ")"
+		if !containsString(s.IndexesUsed, indexName) {
+			s.IndexesUsed = append(s.IndexesUsed, indexName)
+		}
+	}
+
+	if name == "COLLSCAN" {
+		s.CollScan = true
+	}
+
+	fmt.Fprintf(buf, "%s%s\n", strings.Repeat("  ", depth), line)
+
+	if input, ok := lookup(stage, "inputStage").(bson.D); ok {
+		s.walkPlan(buf, input, depth+1)
+	}
+
+	if inputs, ok := lookup(stage, "inputStages").(bson.A); ok {
+		for _, input := range inputs {
+			inputDoc, _ := input.(bson.D)
+			s.walkPlan(buf, inputDoc, depth+1)
+		}
+	}
+}
+
+// lookup returns the value for a dot separated path
+// within a document, or nil if the path is not found.
+func lookup(doc bson.D, path string) interface{} {
+	keys := strings.SplitN(path, ".", 2)
+
+	for _, e := range doc {
+		if e.Key != keys[0] {
+			continue
+		}
+
+		if len(keys) == 1 {
+			return e.Value
+		}
+
+		subDoc, ok := e.Value.(bson.D)
+		if !ok {
+			return nil
+		}
+		return lookup(subDoc, keys[1])
+	}
+
+	return nil
+}
+
+// lookupInt64 returns the numeric value for a path within a document
+// or 0 if the path is not found or is not a number.
+func lookupInt64(doc bson.D, path string) int64 {
+	n, _ := optInt64(bson.E{Key: path, Value: lookup(doc, path)})
+	return n
+}
@@ -0,0 +1,183 @@
+package mongolang
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// testParseDoc parses a JSON string to a bson.D, panicking on errors
+func testParseDoc(s string) bson.D {
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON([]byte(s), false, &doc); err != nil {
+		panic(err)
+	}
+
+	return doc
+}
+
+func TestSummarizeExplain(t *testing.T) {
+	raw := testParseDoc(`{
+		"queryPlanner": {
+			"winningPlan": {
+				"stage": "SORT",
+				"inputStage": {
+					"stage": "FETCH",
+					"inputStage": {
+						"stage": "OR",
+						"inputStages": [
+							{"stage": "IXSCAN", "indexName": "state_1"},
+							{"stage": "IXSCAN", "indexName": "city_1"}
+						]
+					}
+				}
+			}
+		},
+		"executionStats": {
+			"nReturned": 12,
+			"executionTimeMillis": 3,
+			"totalKeysExamined": 40,
+			"totalDocsExamined": 35
+		}
+	}`)
+
+	summary := summarizeExplain(raw)
+
+	expected := "SORT\n  FETCH\n    OR\n      IXSCAN (state_1)\n      IXSCAN (city_1)\n"
+	if summary.Stages != expected {
+		t.Errorf("expected stages:\n%s\ngot:\n%s", expected, summary.Stages)
+	}
+
+	if len(summary.IndexesUsed) != 2 || summary.CollScan || summary.NReturned != 12 ||
+		summary.KeysExamined != 40 || summary.DocsExamined != 35 || summary.ExecutionTimeMillis != 3 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	// aggregate with the query plan in a $cursor stage and SBE queryPlan
+	raw = testParseDoc(`{
+		"stages": [
+			{"$cursor": {
+				"queryPlanner": {"winningPlan": {"queryPlan": {"stage": "COLLSCAN"}}},
+				"executionStats": {"nReturned": 29353, "totalDocsExamined": 29353}
+			}},
+			{"$group": {"_id": "$state"}},
+			{"$sort": {"sortKey": {"_id": 1}}}
+		]
+	}`)
+
+	summary = summarizeExplain(raw)
+
+	expected = "$sort\n  $group\n    COLLSCAN\n"
+	if summary.Stages != expected || !summary.CollScan || summary.DocsExamined != 29353 {
+		t.Errorf("unexpected aggregate summary, stages:\n%s\nsummary: %+v", summary.Stages, summary)
+	}
+
+	// sharded
+	raw = testParseDoc(`{
+		"queryPlanner": {"winningPlan": {"stage": "SHARD_MERGE", "shards": [
+			{"shardName": "shard01", "winningPlan": {"stage": "COLLSCAN"}}
+		]}}
+	}`)
+
+	summary = summarizeExplain(raw)
+	if !strings.Contains(summary.Stages, "shard shard01\n  COLLSCAN") {
+		t.Errorf("unexpected sharded stages:\n%s", summary.Stages)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	doc := testParseDoc(`{"a": {"b": {"c": 5}}, "d": 1}`)
+
+	if lookupInt64(doc, "a.b.c") != 5 || lookup(doc, "a.x") != nil || lookup(doc, "d.e") != nil {
+		t.Errorf("lookup failed for %v", doc)
+	}
+}
+
+func TestExplainCommands(t *testing.T) {
+	c := &Cursor{Collection: &Coll{CollName: "zips"}, IsFindCursor: true,
+		Filter: bson.D{{Key: "state", Value: "CA"}}}
+	c.FindOptions.SetSort(bson.D{{Key: "pop", Value: -1}}).SetLimit(5).SetMaxTime(2 * time.Second)
+
+	cmd, _ := bson.MarshalExtJSON(c.findCommand(), false, false)
+	expected := `{"find":"zips","filter":{"state":"CA"},"sort":{"pop":-1},"limit":5,"maxTimeMS":2000}`
+	if string(cmd) != expected {
+		t.Errorf("expected find command %s, got %s", expected, cmd)
+	}
+
+	c.FindOptions.SetLimit(-5)
+	cmd, _ = bson.MarshalExtJSON(c.findCommand(), false, false)
+	expected = `{"find":"zips","filter":{"state":"CA"},"sort":{"pop":-1},"limit":5,"singleBatch":true,"maxTimeMS":2000}`
+	if string(cmd) != expected {
+		t.Errorf("expected find command %s, got %s", expected, cmd)
+	}
+
+	c = &Cursor{Collection: &Coll{CollName: "zips"},
+		AggrPipeline: bson.A{bson.D{{Key: "$match", Value: bson.D{{Key: "state", Value: "CA"}}}}}}
+	c.AggrOptions.SetAllowDiskUse(true)
+
+	cmd, _ = bson.MarshalExtJSON(c.aggregateCommand(), false, false)
+	expected = `{"aggregate":"zips","pipeline":[{"$match":{"state":"CA"}}],"cursor":{},"allowDiskUse":true}`
+	if string(cmd) != expected {
+		t.Errorf("expected aggregate command %s, got %s", expected, cmd)
+	}
+}
+
+func TestExplainSummaryString(t *testing.T) {
+	summary := ExplainSummary{Stages: "FETCH\n  IXSCAN (state_1)\n", IndexesUsed: []string{"state_1"},
+		NReturned: 12, KeysExamined: 40, DocsExamined: 35, ExecutionTimeMillis: 3}
+
+	expected := "winning plan:\n   FETCH\n     IXSCAN (state_1)\nindexes used: state_1\n" +
+		"returned: 12, keys examined: 40, docs examined: 35, execution time: 3ms\n"
+	if summary.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, summary.String())
+	}
+
+	if !strings.Contains(ExplainSummary{}.String(), "indexes used: none") {
+		t.Errorf("expected no indexes used, got:\n%s", ExplainSummary{}.String())
+	}
+}
+
+func TestExplain(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	explain := db.Coll("zips").Find(`{"state":"CA"}`).Sort(`{"pop":-1}`).Explain(ExecutionStats)
+	if db.Err != nil || explain.Summary.NReturned != 1516 {
+		t.Errorf("TestExplain find returned %d, error: %v", explain.Summary.NReturned, db.Err)
+	}
+
+	explain = db.Coll("zips").Aggregate(`[{"$match":{"state":"CA"}}]`).Explain()
+	if db.Err != nil || explain.Summary.Stages == "" {
+		t.Errorf("TestExplain aggregate had no stages, error: %v", db.Err)
+	}
+
+	explain = db.Coll("zips").ExplainCount(`{"state":"CA"}`)
+	if db.Err != nil || !strings.Contains(explain.Summary.Stages, "COUNT") {
+		t.Errorf("TestExplain count stages:\n%s\nerror: %v", explain.Summary.Stages, db.Err)
+	}
+
+	// explain doesn't delete any documents
+	explain = db.Coll("zips").ExplainDelete(`{"state":"CA"}`, ExecutionStats)
+	if db.Err != nil || db.Coll("zips").CountDocuments(`{"state":"CA"}`) != 1516 {
+		t.Errorf("TestExplain delete error: %v", db.Err)
+	}
+}
+
+func TestExplainDatabase(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(1)})
+	defer server.close()
+	defer db.Disconnect()
+
+	// explain runs on the cursor's collection's Database, not the current one.
+	// The stand-in server doesn't support explain, so only the command is checked.
+	cursor := db.Coll("zips").Find(`{"state":"CA"}`)
+	db.Use("other")
+	cursor.Explain()
+
+	if cmd := server.lastCommand("explain"); lookup(cmd, "$db") != "test" {
+		t.Errorf("expected explain to run on the test Database, got %v", cmd)
+	}
+}
@@ -0,0 +1,520 @@
+package mongolang
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+	A stand-in MongoDB server for tests which don't need a real server.
+
+	It speaks just enough of the wire protocol for the driver to connect
+	and run find, count, insert, delete, getMore, killCursors and simple aggregate
+	commands against documents held in memory. Filters and $match stages
+	only support equality on top level fields, deletes also support $in on _id,
+	and sorts only compare int32 and string values.
+*/
+
+// wire protocol op codes
+const (
+	opReply = 1
+	opQuery = 2004
+	opMsg   = 2013
+)
+
+// fakeServer holds the collections and open cursors for the stand-in server
+type fakeServer struct {
+	listener net.Listener
+
+	mu           sync.Mutex
+	colls        map[string][]bson.D
+	cursors      map[int64][]bson.D
+	nextCursorID int64
+	commands     []string
+	lastCommands map[string]bson.D
+}
+
+// newFakeServer starts a stand-in server with the given collections
+// and returns a DB connected to it using the "test" Database.
+func newFakeServer(t *testing.T, colls map[string][]bson.D) (*fakeServer, *DB) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to start fake server: %v", err)
+	}
+
+	s := &fakeServer{listener: listener, colls: colls, cursors: map[int64][]bson.D{}, nextCursorID: 1000,
+		lastCommands: map[string]bson.D{}}
+	go s.serve()
+
+	db := &DB{}
+	db.InitMonGolang(fmt.Sprintf("mongodb://%s/?connect=direct", listener.Addr())).Use("test")
+	if db.Err != nil {
+		t.Fatalf("unable to connect to fake server: %v", db.Err)
+	}
+
+	return s, db
+}
+
+// close stops the server
+func (s *fakeServer) close() {
+	s.listener.Close()
+}
+
+// openCursors returns the number of server cursors not yet exhausted or killed
+func (s *fakeServer) openCursors() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.cursors)
+}
+
+// commandCount returns the number of times a command has been run
+func (s *fakeServer) commandCount(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, cmd := range s.commands {
+		if cmd == name {
+			count++
+		}
+	}
+
+	return count
+}
+
+// lastCommand returns the last command run with the given name
+func (s *fakeServer) lastCommand(name string) bson.D {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastCommands[name]
+}
+
+// serve accepts connections until the server is closed
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+// handle reads requests from a connection and writes the replies
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return
+		}
+
+		length := int(binary.LittleEndian.Uint32(header[0:]))
+		requestID := binary.LittleEndian.Uint32(header[4:])
+		opCode := binary.LittleEndian.Uint32(header[12:])
+
+		body := make([]byte, length-16)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		var reply []byte
+		switch opCode {
+		case opQuery:
+			// flags, then the collection name, skip and limit before the query
+			i := 4
+			for body[i] != 0 {
+				i++
+			}
+			reply = replyMessage(requestID, s.run(bson.Raw(body[i+9:])))
+		case opMsg:
+			reply = msgMessage(requestID, s.run(msgCommand(body)))
+		default:
+			return
+		}
+
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// msgCommand returns the command from an OP_MSG body, adding
+// any document sequences to it as arrays
+func msgCommand(body []byte) bson.Raw {
+	cmd := bson.D{}
+	i := 4
+	for i < len(body) {
+		kind := body[i]
+		i++
+
+		size := int(binary.LittleEndian.Uint32(body[i:]))
+		if kind == 0 {
+			bson.Unmarshal(body[i:i+size], &cmd)
+			i += size
+			continue
+		}
+
+		section := body[i+4 : i+size]
+		j := 0
+		for section[j] != 0 {
+			j++
+		}
+		name := string(section[:j])
+
+		docs := bson.A{}
+		for k := j + 1; k < len(section); {
+			docSize := int(binary.LittleEndian.Uint32(section[k:]))
+			docs = append(docs, bson.Raw(section[k:k+docSize]))
+			k += docSize
+		}
+		cmd = append(cmd, bson.E{Key: name, Value: docs})
+		i += size
+	}
+
+	raw, _ := bson.Marshal(cmd)
+	return raw
+}
+
+// replyMessage returns an OP_REPLY with a single document
+func replyMessage(responseTo uint32, doc bson.D) []byte {
+	raw, _ := bson.Marshal(doc)
+
+	msg := make([]byte, 36, 36+len(raw))
+	binary.LittleEndian.PutUint32(msg[8:], responseTo)
+	binary.LittleEndian.PutUint32(msg[12:], opReply)
+	binary.LittleEndian.PutUint32(msg[32:], 1)
+	msg = append(msg, raw...)
+	binary.LittleEndian.PutUint32(msg[0:], uint32(len(msg)))
+
+	return msg
+}
+
+// msgMessage returns an OP_MSG with a single document
+func msgMessage(responseTo uint32, doc bson.D) []byte {
+	raw, _ := bson.Marshal(doc)
+
+	msg := make([]byte, 21, 21+len(raw))
+	binary.LittleEndian.PutUint32(msg[8:], responseTo)
+	binary.LittleEndian.PutUint32(msg[12:], opMsg)
+	msg = append(msg, raw...)
+	binary.LittleEndian.PutUint32(msg[0:], uint32(len(msg)))
+
+	return msg
+}
+
+// run runs a command and returns the reply
+func (s *fakeServer) run(raw bson.Raw) bson.D {
+	cmd := bson.D{}
+	if err := bson.Unmarshal(raw, &cmd); err != nil || len(cmd) == 0 {
+		return fakeError("invalid command")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := cmd[0].Key
+	s.commands = append(s.commands, name)
+	s.lastCommands[name] = cmd
+
+	switch name {
+	case "isMaster", "ismaster", "hello":
+		return bson.D{
+			{Key: "ismaster", Value: true},
+			{Key: "helloOk", Value: true},
+			{Key: "maxBsonObjectSize", Value: int32(16 * 1024 * 1024)},
+			{Key: "maxMessageSizeBytes", Value: int32(48000000)},
+			{Key: "maxWriteBatchSize", Value: int32(100000)},
+			{Key: "minWireVersion", Value: int32(0)},
+			{Key: "maxWireVersion", Value: int32(13)},
+			{Key: "ok", Value: 1.0},
+		}
+	case "ping", "buildInfo", "buildinfo":
+		return bson.D{{Key: "ok", Value: 1.0}}
+	case "find":
+		docs := s.filter(cmd[0].Value.(string), lookup(cmd, "filter"))
+		if sortSequence, ok := lookup(cmd, "sort").(bson.D); ok {
+			docs = sortDocs(docs, sortSequence)
+		}
+		docs = skipLimit(docs, lookup(cmd, "skip"), lookup(cmd, "limit"))
+		return s.firstBatch(cmd, docs)
+	case "aggregate":
+		return s.aggregate(cmd)
+	case "insert":
+		return s.insert(cmd)
+	case "delete":
+		return s.delete(cmd)
+	case "count":
+		n := len(s.filter(cmd[0].Value.(string), lookup(cmd, "query")))
+		return bson.D{{Key: "n", Value: int32(n)}, {Key: "ok", Value: 1.0}}
+	case "getMore":
+		return s.getMore(cmd)
+	case "killCursors":
+		ids, _ := lookup(cmd, "cursors").(bson.A)
+		for _, id := range ids {
+			delete(s.cursors, id.(int64))
+		}
+		return bson.D{{Key: "cursorsKilled", Value: ids}, {Key: "ok", Value: 1.0}}
+	}
+
+	return fakeError("no such command: " + name)
+}
+
+// fakeError returns a command error reply
+func fakeError(msg string) bson.D {
+	return bson.D{{Key: "ok", Value: 0.0}, {Key: "errmsg", Value: msg}, {Key: "code", Value: int32(59)}}
+}
+
+// filter returns the documents in a collection which match an equality filter
+func (s *fakeServer) filter(collName string, filter interface{}) []bson.D {
+	return matchDocs(s.colls[collName], filter)
+}
+
+// matchDocs returns the documents which match an equality filter
+func matchDocs(docs []bson.D, filter interface{}) []bson.D {
+	f, _ := filter.(bson.D)
+	result := []bson.D{}
+
+	for _, doc := range docs {
+		match := true
+		for _, e := range f {
+			if fmt.Sprint(lookup(doc, e.Key)) != fmt.Sprint(e.Value) {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			result = append(result, doc)
+		}
+	}
+
+	return result
+}
+
+// skipLimit applies skip and limit values to documents
+func skipLimit(docs []bson.D, skip interface{}, limit interface{}) []bson.D {
+	if n, err := optInt64(bson.E{Value: skip}); err == nil && n > 0 {
+		if int(n) > len(docs) {
+			n = int64(len(docs))
+		}
+		docs = docs[n:]
+	}
+
+	if n, err := optInt64(bson.E{Value: limit}); err == nil && n != 0 {
+		if n < 0 {
+			n = -n
+		}
+		if int(n) < len(docs) {
+			docs = docs[:n]
+		}
+	}
+
+	return docs
+}
+
+// sortDocs returns a sorted copy of documents.
+// Only int32 and string values are compared.
+func sortDocs(docs []bson.D, sortSequence bson.D) []bson.D {
+	result := append([]bson.D{}, docs...)
+
+	sort.SliceStable(result, func(i, j int) bool {
+		for _, e := range sortSequence {
+			a, b := lookup(result[i], e.Key), lookup(result[j], e.Key)
+			if fmt.Sprint(a) == fmt.Sprint(b) {
+				continue
+			}
+
+			var less bool
+			switch av := a.(type) {
+			case int32:
+				bv, _ := b.(int32)
+				less = av < bv
+			default:
+				less = fmt.Sprint(a) < fmt.Sprint(b)
+			}
+
+			if n, _ := optInt64(e); n < 0 {
+				return !less
+			}
+			return less
+		}
+
+		return false
+	})
+
+	return result
+}
+
+// aggregate runs a pipeline of $match, $sort, $skip, $limit, $count and $group stages.
+// $group only supports counting documents, as used by CountDocuments.
+func (s *fakeServer) aggregate(cmd bson.D) bson.D {
+	docs := s.colls[cmd[0].Value.(string)]
+	pipeline, _ := lookup(cmd, "pipeline").(bson.A)
+
+	for _, stage := range pipeline {
+		stageDoc := stage.(bson.D)
+		switch stageDoc[0].Key {
+		case "$match":
+			docs = matchDocs(docs, stageDoc[0].Value)
+		case "$sort":
+			docs = sortDocs(docs, stageDoc[0].Value.(bson.D))
+		case "$skip":
+			docs = skipLimit(docs, stageDoc[0].Value, nil)
+		case "$limit":
+			docs = skipLimit(docs, nil, stageDoc[0].Value)
+		case "$count":
+			if len(docs) > 0 {
+				docs = []bson.D{{{Key: stageDoc[0].Value.(string), Value: int32(len(docs))}}}
+			}
+		case "$group":
+			if len(docs) > 0 {
+				docs = []bson.D{{{Key: "_id", Value: int32(1)}, {Key: "n", Value: int32(len(docs))}}}
+			}
+		default:
+			return fakeError("unsupported stage: " + stageDoc[0].Key)
+		}
+	}
+
+	return s.firstBatch(cmd, docs)
+}
+
+// insert adds documents to a collection, stopping at the first duplicate _id as for an ordered insert
+func (s *fakeServer) insert(cmd bson.D) bson.D {
+	collName := cmd[0].Value.(string)
+	docs, _ := lookup(cmd, "documents").(bson.A)
+
+	n := int32(0)
+	for i, d := range docs {
+		doc, _ := d.(bson.D)
+		if len(matchDocs(s.colls[collName], bson.D{{Key: "_id", Value: lookup(doc, "_id")}})) > 0 {
+			writeErr := bson.D{{Key: "index", Value: int32(i)}, {Key: "code", Value: int32(11000)},
+				{Key: "errmsg", Value: "E11000 duplicate key error"}}
+			return bson.D{{Key: "n", Value: n}, {Key: "writeErrors", Value: bson.A{writeErr}}, {Key: "ok", Value: 1.0}}
+		}
+
+		s.colls[collName] = append(s.colls[collName], doc)
+		n++
+	}
+
+	return bson.D{{Key: "n", Value: n}, {Key: "ok", Value: 1.0}}
+}
+
+// delete removes the documents matching each delete statement's filter
+func (s *fakeServer) delete(cmd bson.D) bson.D {
+	collName := cmd[0].Value.(string)
+	statements, _ := lookup(cmd, "deletes").(bson.A)
+
+	n := int32(0)
+	for _, st := range statements {
+		statement, _ := st.(bson.D)
+		filter, _ := lookup(statement, "q").(bson.D)
+
+		matches := matchDocs(s.colls[collName], filter)
+		if ids, ok := lookup(filter, "_id.$in").(bson.A); ok {
+			matches = []bson.D{}
+			for _, doc := range s.colls[collName] {
+				for _, id := range ids {
+					if fmt.Sprint(lookup(doc, "_id")) == fmt.Sprint(id) {
+						matches = append(matches, doc)
+					}
+				}
+			}
+		}
+
+		if limit, _ := optInt64(bson.E{Value: lookup(statement, "limit")}); limit > 0 && len(matches) > int(limit) {
+			matches = matches[:limit]
+		}
+
+		kept := []bson.D{}
+		for _, doc := range s.colls[collName] {
+			deleted := false
+			for _, match := range matches {
+				if fmt.Sprint(lookup(match, "_id")) == fmt.Sprint(lookup(doc, "_id")) {
+					deleted = true
+				}
+			}
+
+			if deleted {
+				n++
+			} else {
+				kept = append(kept, doc)
+			}
+		}
+		s.colls[collName] = kept
+	}
+
+	return bson.D{{Key: "n", Value: n}, {Key: "ok", Value: 1.0}}
+}
+
+// firstBatch returns the first batch of documents for a find or aggregate,
+// saving the rest for getMore. The batchSize defaults to 101.
+func (s *fakeServer) firstBatch(cmd bson.D, docs []bson.D) bson.D {
+	batchSize := int64(101)
+	if n, err := optInt64(bson.E{Value: lookup(cmd, "batchSize")}); err == nil && n > 0 {
+		batchSize = n
+	}
+	if n, err := optInt64(bson.E{Value: lookup(cmd, "cursor.batchSize")}); err == nil && n > 0 {
+		batchSize = n
+	}
+
+	return s.batch(cmd[0].Value.(string), docs, batchSize, 0, "firstBatch")
+}
+
+// getMore returns the next batch for a cursor
+func (s *fakeServer) getMore(cmd bson.D) bson.D {
+	id, _ := cmd[0].Value.(int64)
+	docs, found := s.cursors[id]
+	if !found {
+		return fakeError(fmt.Sprintf("cursor id %d not found", id))
+	}
+
+	batchSize := int64(101)
+	if n, err := optInt64(bson.E{Value: lookup(cmd, "batchSize")}); err == nil && n > 0 {
+		batchSize = n
+	}
+
+	collName, _ := lookup(cmd, "collection").(string)
+	delete(s.cursors, id)
+	return s.batch(collName, docs, batchSize, id, "nextBatch")
+}
+
+// batch returns a batch of documents, saving any remaining documents for getMore
+func (s *fakeServer) batch(collName string, docs []bson.D, batchSize int64, id int64, field string) bson.D {
+	batch := bson.A{}
+	for i := 0; i < len(docs) && int64(i) < batchSize; i++ {
+		batch = append(batch, docs[i])
+	}
+
+	cursorID := int64(0)
+	if len(docs) > len(batch) {
+		cursorID = id
+		if cursorID == 0 {
+			s.nextCursorID++
+			cursorID = s.nextCursorID
+		}
+		s.cursors[cursorID] = docs[len(batch):]
+	}
+
+	return bson.D{
+		{Key: "cursor", Value: bson.D{
+			{Key: "id", Value: cursorID},
+			{Key: "ns", Value: "test." + collName},
+			{Key: field, Value: batch},
+		}},
+		{Key: "ok", Value: 1.0},
+	}
+}
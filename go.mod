@@ -3,6 +3,6 @@ module github.com/ddgarrett/mongolang
 go 1.15
 
 require (
-	go.mongodb.org/mongo-driver v1.5.0
-	golang.org/x/text v0.3.3
+	go.mongodb.org/mongo-driver v1.11.9
+	golang.org/x/text v0.3.7
 )
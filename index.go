@@ -0,0 +1,308 @@
+package mongolang
+
+/*
+	Methods to manage the indexes for a Collection.
+
+	Index keys and options use the same JSON as the MongoDB Shell:
+
+		db.Coll("zips").CreateIndex(`{"state":1,"pop":-1}`)
+		db.Coll("sessions").CreateIndex(`{"lastAccess":1}`, `{"expireAfterSeconds":3600}`)
+		db.Coll("zips").GetIndexes()
+		db.Coll("zips").DropIndex("state_1_pop_-1")
+
+	Index options are passed to the server as is so that options
+	added in new MongoDB releases can be used without changes to MonGolang.
+*/
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IndexInfo describes an index as returned by GetIndexes().
+// Spec contains the complete index specification, including any
+// options not broken out into separate fields, such as collation.
+type IndexInfo struct {
+	Name                    string
+	Key                     bson.D
+	Unique                  bool
+	Sparse                  bool
+	Hidden                  bool
+	ExpireAfterSeconds      *int64
+	PartialFilterExpression bson.D
+
+	Spec bson.D
+}
+
+// String returns the index specification as JSON
+func (i IndexInfo) String() string {
+	json, err := bson.MarshalExtJSON(i.Spec, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", i.Spec)
+	}
+
+	return string(json)
+}
+
+// CreateIndex creates an index and returns the name of the index.
+// Keys must be a JSON string or bson.D, such as `{"state":1,"pop":-1}`,
+// since the order of the keys is significant.
+// The optional opts[0] is a JSON string, bson.D or bson.M with any of
+// the index options supported by the server, such as
+// `{"unique":true,"partialFilterExpression":{"pop":{"$gt":0}}}`.
+// If no name option is given, the name is generated from the keys,
+// for example "state_1_pop_-1".
+func (c *Coll) CreateIndex(keys interface{}, opts ...interface{}) string {
+	names := c.createIndexes([]interface{}{keys}, opts)
+	if len(names) == 0 {
+		return ""
+	}
+
+	return names[0]
+}
+
+// CreateIndexes creates multiple indexes with a single call and returns the index names.
+// KeyPatterns must be a JSON array, bson.A or []bson.D of index keys, such as
+// `[{"state":1}, {"city":1,"state":1}]`.
+// The optional opts[0] contains index options which are applied to every index.
+func (c *Coll) CreateIndexes(keyPatterns interface{}, opts ...interface{}) []string {
+	if !c.collOkay() {
+		return []string{}
+	}
+
+	c.resetErrors()
+
+	patterns, err := verifyParm(keyPatterns, interfaceSliceAllowed)
+	c.DB.Err = err
+	if err != nil {
+		return []string{}
+	}
+
+	return c.createIndexes(patterns.([]interface{}), opts)
+}
+
+// createIndexes runs the createIndexes command for a list of index keys
+func (c *Coll) createIndexes(keyPatterns []interface{}, opts []interface{}) []string {
+	names := []string{}
+
+	if !c.collOkay() {
+		return names
+	}
+
+	c.resetErrors()
+
+	indexOpts, err := optionsParm(opts)
+	c.DB.Err = err
+	if err != nil {
+		return names
+	}
+
+	if len(keyPatterns) > 1 && lookup(indexOpts, "name") != nil {
+		c.DB.Err = fmt.Errorf("name option not allowed when creating multiple indexes")
+		return names
+	}
+
+	specs := bson.A{}
+	for _, keyPattern := range keyPatterns {
+		keys, err := indexKeys(keyPattern)
+		c.DB.Err = err
+		if err != nil {
+			return []string{}
+		}
+
+		spec := indexSpec(keys, indexOpts)
+		specs = append(specs, spec)
+		names = append(names, spec[1].Value.(string))
+	}
+
+	cmd := bson.D{{Key: "createIndexes", Value: c.CollName}, {Key: "indexes", Value: specs}}
+	c.DB.Err = c.MongoColl.Database().RunCommand(context.Background(), cmd).Err()
+	if c.DB.Err != nil {
+		return []string{}
+	}
+
+	return names
+}
+
+// GetIndexes returns a description of each of the indexes for the collection
+func (c *Coll) GetIndexes() []IndexInfo {
+	result := []IndexInfo{}
+
+	if !c.collOkay() {
+		return result
+	}
+
+	c.resetErrors()
+
+	cursor, err := c.MongoColl.Indexes().List(context.Background())
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	specs := []bson.D{}
+	c.DB.Err = cursor.All(context.Background(), &specs)
+
+	for _, spec := range specs {
+		result = append(result, indexInfo(spec))
+	}
+
+	return result
+}
+
+// DropIndex drops an index given either the index name
+// or the index keys, such as `{"state":1,"pop":-1}`.
+func (c *Coll) DropIndex(nameOrKeys interface{}) {
+	if !c.collOkay() {
+		return
+	}
+
+	c.resetErrors()
+
+	index, err := indexNameOrKeys(nameOrKeys)
+	c.DB.Err = err
+	if err != nil {
+		return
+	}
+
+	cmd := bson.D{{Key: "dropIndexes", Value: c.CollName}, {Key: "index", Value: index}}
+	c.DB.Err = c.MongoColl.Database().RunCommand(context.Background(), cmd).Err()
+}
+
+// DropIndexes drops all of the indexes for the collection
+// except for the index on _id.
+func (c *Coll) DropIndexes() {
+	if !c.collOkay() {
+		return
+	}
+
+	c.resetErrors()
+
+	cmd := bson.D{{Key: "dropIndexes", Value: c.CollName}, {Key: "index", Value: "*"}}
+	c.DB.Err = c.MongoColl.Database().RunCommand(context.Background(), cmd).Err()
+}
+
+// HideIndex hides an index from the query planner, given either
+// the index name or the index keys. The index is still maintained
+// so it can be unhidden without having to rebuild it.
+func (c *Coll) HideIndex(nameOrKeys interface{}) {
+	c.setIndexHidden(nameOrKeys, true)
+}
+
+// UnhideIndex makes a hidden index visible to the query planner again.
+func (c *Coll) UnhideIndex(nameOrKeys interface{}) {
+	c.setIndexHidden(nameOrKeys, false)
+}
+
+// setIndexHidden uses collMod to hide or unhide an index
+func (c *Coll) setIndexHidden(nameOrKeys interface{}, hidden bool) {
+	if !c.collOkay() {
+		return
+	}
+
+	c.resetErrors()
+
+	index, err := indexNameOrKeys(nameOrKeys)
+	c.DB.Err = err
+	if err != nil {
+		return
+	}
+
+	indexField := "keyPattern"
+	if _, ok := index.(string); ok {
+		indexField = "name"
+	}
+
+	cmd := bson.D{
+		{Key: "collMod", Value: c.CollName},
+		{Key: "index", Value: bson.D{{Key: indexField, Value: index}, {Key: "hidden", Value: hidden}}},
+	}
+	c.DB.Err = c.MongoColl.Database().RunCommand(context.Background(), cmd).Err()
+}
+
+// indexKeys verifies the keys for an index.
+// Keys must be a bson.D, or parse to one, since key order is significant.
+func indexKeys(keys interface{}) (bson.D, error) {
+	parm, err := verifyParm(keys, bsonDAllowed)
+	if err != nil {
+		return nil, err
+	}
+
+	result := parm.(bson.D)
+	if len(result) == 0 {
+		return nil, fmt.Errorf("index keys must contain at least one field")
+	}
+
+	return result, nil
+}
+
+// indexNameOrKeys returns either an index name or index keys.
+// A string is an index name unless it is a JSON document.
+func indexNameOrKeys(nameOrKeys interface{}) (interface{}, error) {
+	if s, ok := nameOrKeys.(string); ok && !strings.HasPrefix(strings.TrimSpace(s), "{") {
+		return s, nil
+	}
+
+	return indexKeys(nameOrKeys)
+}
+
+// indexSpec returns the spec for a createIndexes command.
+// The spec always starts with the key and name fields,
+// followed by any other options.
+func indexSpec(keys bson.D, opts bson.D) bson.D {
+	name, ok := lookup(opts, "name").(string)
+	if !ok {
+		name = indexName(keys)
+	}
+
+	spec := bson.D{{Key: "key", Value: keys}, {Key: "name", Value: name}}
+	for _, opt := range opts {
+		if opt.Key != "name" && opt.Key != "key" {
+			spec = append(spec, opt)
+		}
+	}
+
+	return spec
+}
+
+// indexName generates an index name from the index keys
+// the same way the MongoDB Shell does, for example "state_1_pop_-1".
+func indexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		parts = append(parts, k.Key, fmt.Sprintf("%v", k.Value))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// indexInfo creates an IndexInfo from an index specification
+func indexInfo(spec bson.D) IndexInfo {
+	result := IndexInfo{Spec: spec}
+
+	for _, e := range spec {
+		switch e.Key {
+		case "name":
+			result.Name, _ = e.Value.(string)
+		case "key":
+			result.Key, _ = e.Value.(bson.D)
+		case "unique":
+			result.Unique, _ = e.Value.(bool)
+		case "sparse":
+			result.Sparse, _ = e.Value.(bool)
+		case "hidden":
+			result.Hidden, _ = e.Value.(bool)
+		case "expireAfterSeconds":
+			if n, err := optInt64(e); err == nil {
+				result.ExpireAfterSeconds = &n
+			}
+		case "partialFilterExpression":
+			result.PartialFilterExpression, _ = e.Value.(bson.D)
+		}
+	}
+
+	return result
+}
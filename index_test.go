@@ -0,0 +1,142 @@
+package mongolang
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexSpec(t *testing.T) {
+	keys, err := indexKeys(`{"state":1,"pop":-1}`)
+	if err != nil {
+		t.Fatalf("indexKeys error: %v", err)
+	}
+
+	if indexName(keys) != "state_1_pop_-1" {
+		t.Errorf("expected index name state_1_pop_-1, got %s", indexName(keys))
+	}
+
+	opts, _ := optionsParm([]interface{}{`{"unique":true,"expireAfterSeconds":3600}`})
+	spec := indexSpec(keys, opts)
+	if len(spec) != 4 || spec[0].Key != "key" || spec[1].Value != "state_1_pop_-1" || spec[2].Key != "unique" {
+		t.Errorf("unexpected index spec: %v", spec)
+	}
+
+	opts, _ = optionsParm([]interface{}{`{"name":"statePop"}`})
+	spec = indexSpec(keys, opts)
+	if len(spec) != 2 || spec[1].Value != "statePop" {
+		t.Errorf("unexpected index spec with name: %v", spec)
+	}
+
+	info := indexInfo(indexSpec(keys, bson.D{
+		{Key: "unique", Value: true},
+		{Key: "expireAfterSeconds", Value: int32(3600)},
+		{Key: "partialFilterExpression", Value: bson.D{{Key: "pop", Value: bson.D{{Key: "$gt", Value: 0}}}}},
+	}))
+
+	if info.Name != "state_1_pop_-1" || !info.Unique || info.Sparse || len(info.Key) != 2 ||
+		info.ExpireAfterSeconds == nil || *info.ExpireAfterSeconds != 3600 ||
+		len(info.PartialFilterExpression) != 1 {
+		t.Errorf("unexpected index info: %+v", info)
+	}
+
+	// name or keys
+	index, err := indexNameOrKeys("state_1")
+	if err != nil || index != "state_1" {
+		t.Errorf("expected index name state_1, got %v, error: %v", index, err)
+	}
+
+	index, err = indexNameOrKeys(` {"state":1}`)
+	if _, ok := index.(bson.D); err != nil || !ok {
+		t.Errorf("expected index keys, got %v, error: %v", index, err)
+	}
+
+	if _, err = indexKeys(`{}`); err == nil {
+		t.Error("expected error for empty index keys")
+	}
+
+	if _, err = indexKeys(bson.M{"state": 1}); err == nil {
+		t.Error("expected error for bson.M index keys")
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	coll := db.Coll("testCollection")
+	coll.InsertOne(`{"testCase":"index"}`)
+	coll.DropIndexes()
+
+	name := coll.CreateIndex(`{"state":1,"pop":-1}`)
+	if db.Err != nil || name != "state_1_pop_-1" {
+		t.Errorf("CreateIndex returned %s, error: %v", name, db.Err)
+	}
+
+	coll.CreateIndex(`{"lastAccess":1}`, `{"expireAfterSeconds":3600, "name":"ttl"}`)
+	if db.Err != nil {
+		t.Errorf("CreateIndex with options error: %v", db.Err)
+	}
+
+	names := coll.CreateIndexes(`[{"city":1}, {"zip":1}]`, `{"sparse":true}`)
+	if db.Err != nil || len(names) != 2 || names[1] != "zip_1" {
+		t.Errorf("CreateIndexes returned %v, error: %v", names, db.Err)
+	}
+
+	coll.HideIndex(`{"city":1}`)
+	if db.Err != nil {
+		t.Errorf("HideIndex error: %v", db.Err)
+	}
+
+	indexes := map[string]IndexInfo{}
+	for _, info := range coll.GetIndexes() {
+		indexes[info.Name] = info
+	}
+
+	if len(indexes) != 5 || !indexes["city_1"].Hidden || !indexes["zip_1"].Sparse ||
+		indexes["ttl"].ExpireAfterSeconds == nil {
+		t.Errorf("GetIndexes returned %v, error: %v", indexes, db.Err)
+	}
+
+	coll.UnhideIndex("city_1")
+	coll.DropIndex("ttl")
+	coll.DropIndex(`{"state":1,"pop":-1}`)
+	if db.Err != nil || len(coll.GetIndexes()) != 3 {
+		t.Errorf("expected 3 indexes after DropIndex, error: %v", db.Err)
+	}
+
+	coll.DropIndex("notAnIndex")
+	if db.Err == nil {
+		t.Error("DropIndex of missing index expected error")
+	}
+
+	coll.DropIndexes()
+	if db.Err != nil || len(coll.GetIndexes()) != 1 {
+		t.Errorf("expected only _id index after DropIndexes, error: %v", db.Err)
+	}
+
+	coll.DeleteMany(`{"testCase":"index"}`)
+}
+
+func TestIndexCommandsDatabase(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(1)})
+	defer server.close()
+	defer db.Disconnect()
+
+	// index commands run on the collection's Database, not the current one.
+	// The stand-in server doesn't support them, so only the commands are checked.
+	zips := db.Coll("zips")
+	db.Use("other")
+
+	zips.CreateIndex(`{"state":1}`)
+	zips.HideIndex("state_1")
+	zips.DropIndex("state_1")
+	zips.DropIndexes()
+
+	for _, name := range []string{"createIndexes", "collMod", "dropIndexes"} {
+		if cmd := server.lastCommand(name); lookup(cmd, "$db") != "test" {
+			t.Errorf("expected %s to run on the test Database, got %v", name, cmd)
+		}
+	}
+}
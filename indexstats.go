@@ -0,0 +1,298 @@
+package mongolang
+
+/*
+	Methods to report on index usage in order to find indexes
+	which can be dropped because they are never used or are redundant.
+
+		db.Coll("zips").IndexStats()
+		db.IndexReport().Print()
+
+	Note that index usage statistics are reset when the server restarts
+	so an index that is needed only occasionally may show as unused.
+*/
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IndexStat is the usage of an index since Since,
+// typically the time that the server was last restarted.
+// Ops is the total for all hosts.
+type IndexStat struct {
+	Name  string
+	Key   bson.D
+	Ops   int64
+	Since time.Time
+}
+
+// IndexReportEntry describes an index and its usage.
+// Unused is true if the index has not been used since the server restarted.
+// Redundant is true if the keys for the index are a prefix
+// of the keys for another index, named in RedundantOf.
+// Unique, partial and TTL indexes are never flagged since they do
+// more than speed up queries and so aren't candidates to be dropped.
+type IndexReportEntry struct {
+	Coll  string
+	Name  string
+	Key   bson.D
+	Ops   int64
+	Since time.Time
+	Size  int64
+
+	Unused      bool
+	Redundant   bool
+	RedundantOf string
+
+	unique  bool
+	partial bool
+	ttl     bool
+}
+
+// IndexReport lists the indexes for a Database
+type IndexReport []IndexReportEntry
+
+// IndexStats returns the usage statistics for each index on the collection
+func (c *Coll) IndexStats() []IndexStat {
+	result := []IndexStat{}
+
+	if !c.collOkay() {
+		return result
+	}
+
+	c.resetErrors()
+
+	pipeline := []bson.D{{{Key: "$indexStats", Value: bson.D{}}}}
+	cursor, err := c.MongoColl.Aggregate(context.Background(), pipeline)
+	c.DB.Err = err
+	if err != nil {
+		return result
+	}
+
+	stats := []struct {
+		Name     string `bson:"name"`
+		Key      bson.D `bson:"key"`
+		Accesses struct {
+			Ops   int64     `bson:"ops"`
+			Since time.Time `bson:"since"`
+		} `bson:"accesses"`
+	}{}
+
+	c.DB.Err = cursor.All(context.Background(), &stats)
+
+	// combine stats for the same index on different hosts
+	index := map[string]int{}
+	for _, s := range stats {
+		i, found := index[s.Name]
+		if !found {
+			index[s.Name] = len(result)
+			result = append(result, IndexStat{Name: s.Name, Key: s.Key, Since: s.Accesses.Since})
+			i = len(result) - 1
+		}
+
+		result[i].Ops += s.Accesses.Ops
+		if s.Accesses.Since.Before(result[i].Since) {
+			result[i].Since = s.Accesses.Since
+		}
+	}
+
+	return result
+}
+
+// indexSizes returns the size in bytes of each index on the collection
+func (c *Coll) indexSizes() (map[string]int64, error) {
+	result := map[string]int64{}
+
+	pipeline := []bson.D{{{Key: "$collStats", Value: bson.D{{Key: "storageStats", Value: bson.D{}}}}}}
+	cursor, err := c.MongoColl.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return result, err
+	}
+
+	stats := []struct {
+		StorageStats struct {
+			IndexSizes bson.D `bson:"indexSizes"`
+		} `bson:"storageStats"`
+	}{}
+
+	if err = cursor.All(context.Background(), &stats); err != nil {
+		return result, err
+	}
+
+	// sharded collections have one result per shard
+	for _, s := range stats {
+		for _, e := range s.StorageStats.IndexSizes {
+			size, _ := optInt64(e)
+			result[e.Key] += size
+		}
+	}
+
+	return result, nil
+}
+
+// IndexReport lists every index in the current Database with its usage
+// since the server restarted and its size. Indexes which have never been used,
+// or are redundant because they are a prefix of another index, are flagged.
+// The _id index is never flagged since it can't be dropped.
+func (mg *DB) IndexReport() IndexReport {
+	result := IndexReport{}
+
+	if !mg.dbOkay() {
+		return result
+	}
+
+	collNames, err := mg.Database.ListCollectionNames(context.Background(), bson.D{{Key: "type", Value: "collection"}})
+	mg.Err = err
+	if err != nil {
+		return result
+	}
+
+	for _, collName := range collNames {
+		if strings.HasPrefix(collName, "system.") {
+			continue
+		}
+
+		coll := mg.Coll(collName)
+
+		indexes := coll.GetIndexes()
+		if mg.Err != nil {
+			return result
+		}
+
+		stats := map[string]IndexStat{}
+		for _, s := range coll.IndexStats() {
+			stats[s.Name] = s
+		}
+		if mg.Err != nil {
+			return result
+		}
+
+		sizes, err := coll.indexSizes()
+		mg.Err = err
+		if err != nil {
+			return result
+		}
+
+		entries := []IndexReportEntry{}
+		for _, index := range indexes {
+			entries = append(entries, IndexReportEntry{
+				Coll:    collName,
+				Name:    index.Name,
+				Key:     index.Key,
+				Ops:     stats[index.Name].Ops,
+				Since:   stats[index.Name].Since,
+				Size:    sizes[index.Name],
+				unique:  index.Unique,
+				partial: index.PartialFilterExpression != nil,
+				ttl:     index.ExpireAfterSeconds != nil,
+			})
+		}
+
+		result = append(result, flagIndexes(entries)...)
+	}
+
+	return result
+}
+
+// flagIndexes flags the unused and redundant indexes for a single collection
+func flagIndexes(entries []IndexReportEntry) []IndexReportEntry {
+	for i := range entries {
+		entry := &entries[i]
+
+		// unique, partial and TTL indexes do more than speed up queries
+		if entry.Name == "_id_" || entry.unique || entry.partial || entry.ttl {
+			continue
+		}
+
+		entry.Unused = entry.Ops == 0
+
+		for _, other := range entries {
+			if other.Name != entry.Name && other.Name != "_id_" && !other.partial &&
+				isKeyPrefix(entry.Key, other.Key) {
+				entry.Redundant = true
+				entry.RedundantOf = other.Name
+				break
+			}
+		}
+	}
+
+	return entries
+}
+
+// isKeyPrefix returns true if the index keys in prefix are
+// a leading subset of the index keys in keys, with the same sort order.
+// Identical keys are not considered a prefix.
+func isKeyPrefix(prefix bson.D, keys bson.D) bool {
+	if len(prefix) == 0 || len(prefix) >= len(keys) {
+		return false
+	}
+
+	for i, k := range prefix {
+		if k.Key != keys[i].Key || fmt.Sprintf("%v", k.Value) != fmt.Sprintf("%v", keys[i].Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the IndexReport formatted as a table
+func (r IndexReport) String() string {
+	var buf bytes.Buffer
+
+	rows := [][]string{{"collection", "index", "ops", "size", "since", "flags"}}
+	for _, entry := range r {
+		flags := []string{}
+		if entry.Unused {
+			flags = append(flags, "UNUSED")
+		}
+		if entry.Redundant {
+			flags = append(flags, "REDUNDANT (prefix of "+entry.RedundantOf+")")
+		}
+
+		since := ""
+		if !entry.Since.IsZero() {
+			since = entry.Since.Format(time.RFC3339)
+		}
+
+		rows = append(rows, []string{entry.Coll, entry.Name, fmt.Sprintf("%d", entry.Ops),
+			fmt.Sprintf("%d", entry.Size), since, strings.Join(flags, ", ")})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, col := range row {
+			if len(col) > widths[i] {
+				widths[i] = len(col)
+			}
+		}
+	}
+
+	for _, row := range rows {
+		var line bytes.Buffer
+		for i, col := range row {
+			switch {
+			case i == len(row)-1:
+				line.WriteString(col)
+			case i == 2 || i == 3:
+				fmt.Fprintf(&line, "%*s  ", widths[i], col)
+			default:
+				fmt.Fprintf(&line, "%-*s  ", widths[i], col)
+			}
+		}
+		buf.WriteString(strings.TrimRight(line.String(), " "))
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+// Print prints the IndexReport as a table
+func (r IndexReport) Print() {
+	fmt.Print(r.String())
+}
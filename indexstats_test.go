@@ -0,0 +1,115 @@
+package mongolang
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func testIndexKeys(s string) bson.D {
+	keys, err := indexKeys(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return keys
+}
+
+func TestFlagIndexes(t *testing.T) {
+	entries := flagIndexes([]IndexReportEntry{
+		{Coll: "zips", Name: "_id_", Key: testIndexKeys(`{"_id":1}`)},
+		{Coll: "zips", Name: "state_1", Key: testIndexKeys(`{"state":1}`), Ops: 10},
+		{Coll: "zips", Name: "state_1_city_1", Key: testIndexKeys(`{"state":1,"city":1}`), Ops: 5},
+		{Coll: "zips", Name: "state_-1", Key: testIndexKeys(`{"state":-1}`)},
+		{Coll: "zips", Name: "city_1", Key: testIndexKeys(`{"city":1}`), unique: true},
+		{Coll: "zips", Name: "city_1_pop_1", Key: testIndexKeys(`{"city":1,"pop":1}`), Ops: 1},
+		{Coll: "zips", Name: "created_1", Key: testIndexKeys(`{"created":1}`), ttl: true},
+		{Coll: "zips", Name: "pop_1", Key: testIndexKeys(`{"pop":1}`), partial: true},
+	})
+
+	expected := []struct {
+		unused      bool
+		redundantOf string
+	}{
+		{false, ""},
+		{false, "state_1_city_1"},
+		{false, ""},
+		{true, ""},
+		{false, ""},
+		{false, ""},
+		{false, ""},
+		{false, ""},
+	}
+
+	for i, e := range expected {
+		if entries[i].Unused != e.unused || entries[i].RedundantOf != e.redundantOf ||
+			entries[i].Redundant != (e.redundantOf != "") {
+			t.Errorf("index %s flagged unused: %v, redundant of: %q",
+				entries[i].Name, entries[i].Unused, entries[i].RedundantOf)
+		}
+	}
+}
+
+func ExampleIndexReport_Print() {
+	report := IndexReport(flagIndexes([]IndexReportEntry{
+		{Coll: "zips", Name: "_id_", Key: testIndexKeys(`{"_id":1}`), Ops: 12, Size: 299008},
+		{Coll: "zips", Name: "state_1", Key: testIndexKeys(`{"state":1}`), Size: 36864},
+		{Coll: "zips", Name: "state_1_pop_-1", Key: testIndexKeys(`{"state":1,"pop":-1}`), Ops: 3, Size: 139264},
+	}))
+
+	report.Print()
+
+	// output:
+	// collection  index           ops    size  since  flags
+	// zips        _id_             12  299008
+	// zips        state_1           0   36864         UNUSED, REDUNDANT (prefix of state_1_pop_-1)
+	// zips        state_1_pop_-1    3  139264
+}
+
+func TestIndexReport(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	coll := db.Coll("testCollection")
+	coll.InsertOne(`{"testCase":"indexReport"}`)
+	coll.DropIndexes()
+	coll.CreateIndex(`{"testCase":1}`)
+	coll.CreateIndex(`{"testCase":1,"seq":1}`)
+
+	findOptions := options.Find().SetHint(bson.D{{Key: "testCase", Value: 1}, {Key: "seq", Value: 1}})
+	cursor, err := coll.MongoColl.Find(context.Background(), bson.D{{Key: "testCase", Value: "indexReport"}}, findOptions)
+	if err != nil {
+		t.Fatalf("TestIndexReport find error: %v", err)
+	}
+	cursor.All(context.Background(), &[]bson.D{})
+
+	stats := coll.IndexStats()
+	if db.Err != nil || len(stats) != 3 {
+		t.Errorf("IndexStats returned %v, error: %v", stats, db.Err)
+	}
+
+	report := db.IndexReport()
+	if db.Err != nil {
+		t.Fatalf("IndexReport error: %v", db.Err)
+	}
+
+	found := false
+	for _, entry := range report {
+		if entry.Coll == "testCollection" && entry.Name == "testCase_1" {
+			found = true
+			if !entry.Unused || entry.RedundantOf != "testCase_1_seq_1" || entry.Size == 0 {
+				t.Errorf("IndexReport entry not flagged correctly: %+v", entry)
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("IndexReport did not include testCase_1 index:\n%s", report)
+	}
+
+	coll.DropIndexes()
+	coll.DeleteMany(`{"testCase":"indexReport"}`)
+}
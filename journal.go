@@ -0,0 +1,378 @@
+package mongolang
+
+/*
+	Methods to support an optional journal of inserts and deletes.
+
+	When journaling is enabled for a DB, Coll.InsertOne() and Coll.InsertMany()
+	record the _id of each inserted document and Coll.DeleteOne() and
+	Coll.DeleteMany() record a copy of each document before it is deleted.
+
+	The journal is kept either in a local file, one Extended JSON
+	entry per line, or in a designated collection:
+
+		db.JournalToFile("fixes.jsonl")
+		db.JournalToColl("mongolangJournal")
+
+	DB.Undo(n) then reverses the last n journal entries, removing
+	inserted documents and restoring deleted documents.
+	This provides a safety net for ad-hoc data fixes, for example
+	when running in a Jupyter notebook.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Journal entry operations
+const (
+	JournalInsert = "insert"
+	JournalDelete = "delete"
+)
+
+// JournalEntry is a single entry in the journal.
+// Inserts record the _id of the inserted documents in IDs.
+// Deletes record a copy of the deleted documents in Docs.
+type JournalEntry struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty"`
+	Op   string             `bson:"op"`
+	DB   string             `bson:"db"`
+	Coll string             `bson:"coll"`
+	Time time.Time          `bson:"ts"`
+	IDs  []interface{}      `bson:"ids,omitempty"`
+	Docs []bson.D           `bson:"docs,omitempty"`
+}
+
+// JournalToFile starts journaling inserts and deletes
+// to a local JSON Lines file. Entries are appended to any
+// already in the file.
+func (mg *DB) JournalToFile(filePath string) *DB {
+	mg.Journal = &Journal{FilePath: filePath}
+	return mg
+}
+
+// JournalToColl starts journaling inserts and deletes
+// to a collection in the current Database.
+func (mg *DB) JournalToColl(collName string) *DB {
+	if !mg.dbOkay() {
+		return mg
+	}
+
+	mg.Journal = &Journal{DBName: mg.Name, CollName: collName}
+	return mg
+}
+
+// StopJournal stops journaling. Any existing journal
+// file or collection is left as is.
+func (mg *DB) StopJournal() *DB {
+	mg.Journal = nil
+	return mg
+}
+
+// journaling returns true if journaling is enabled
+func (mg *DB) journaling() bool {
+	return mg.Journal != nil
+}
+
+// journalColl returns the MongoDB Collection the journal is kept in.
+func (mg *DB) journalColl() *mongo.Collection {
+	return mg.Client.Database(mg.Journal.DBName).Collection(mg.Journal.CollName)
+}
+
+// writeJournal appends an entry to the journal
+func (mg *DB) writeJournal(entry JournalEntry) error {
+	entry.Time = time.Now()
+
+	if mg.Journal.FilePath != "" {
+		return appendJournalFile(mg.Journal.FilePath, entry)
+	}
+
+	if !mg.clientOkay() {
+		return ErrNotConnected
+	}
+
+	_, err := mg.journalColl().InsertOne(context.Background(), entry)
+	return err
+}
+
+// JournalEntries returns all of the journal entries, oldest first.
+func (mg *DB) JournalEntries() []JournalEntry {
+	result := []JournalEntry{}
+
+	if !mg.journaling() {
+		mg.Err = ErrNoJournal
+		return result
+	}
+
+	if mg.Journal.FilePath != "" {
+		result, mg.Err = readJournalFile(mg.Journal.FilePath)
+		return result
+	}
+
+	if !mg.clientOkay() {
+		return result
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := mg.journalColl().Find(context.Background(), bson.D{}, findOptions)
+	if err != nil {
+		mg.Err = err
+		return result
+	}
+
+	mg.Err = cursor.All(context.Background(), &result)
+	return result
+}
+
+// Undo reverses the last lastN journal entries, newest first.
+// Inserted documents are deleted and deleted documents are
+// inserted again. Each entry is removed from the journal once
+// it has been undone.
+// Returns the number of entries undone. If an error occurs
+// the remaining entries are left in the journal and DB.Err is set.
+func (mg *DB) Undo(lastN int) int {
+	entries := mg.JournalEntries()
+	if mg.Err != nil || !mg.clientOkay() {
+		return 0
+	}
+
+	undone := 0
+	for i := len(entries) - 1; i >= 0 && undone < lastN; i-- {
+		mg.Err = mg.undoEntry(entries[i])
+		if mg.Err != nil {
+			break
+		}
+		undone++
+	}
+
+	err := mg.removeJournalEntries(entries, undone)
+	if mg.Err == nil {
+		mg.Err = err
+	}
+
+	return undone
+}
+
+// undoEntry reverses a single journal entry
+func (mg *DB) undoEntry(entry JournalEntry) error {
+	coll := mg.Client.Database(entry.DB).Collection(entry.Coll)
+
+	switch entry.Op {
+	case JournalInsert:
+		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: entry.IDs}}}}
+		_, err := coll.DeleteMany(context.Background(), filter)
+		return err
+
+	case JournalDelete:
+		if len(entry.Docs) == 0 {
+			return nil
+		}
+
+		docs := make([]interface{}, len(entry.Docs))
+		for i, doc := range entry.Docs {
+			docs[i] = doc
+		}
+
+		// A document may already exist if the delete that was
+		// journaled failed, so ignore duplicate key errors
+		_, err := coll.InsertMany(context.Background(), docs, options.InsertMany().SetOrdered(false))
+		if isDuplicateKeyOnly(err) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// removeJournalEntries removes the last n entries from the journal
+func (mg *DB) removeJournalEntries(entries []JournalEntry, n int) error {
+	if n == 0 {
+		return nil
+	}
+
+	remaining := entries[:len(entries)-n]
+
+	if mg.Journal.FilePath != "" {
+		return writeJournalFile(mg.Journal.FilePath, remaining)
+	}
+
+	ids := make([]interface{}, n)
+	for i, entry := range entries[len(remaining):] {
+		ids[i] = entry.ID
+	}
+
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	_, err := mg.journalColl().DeleteMany(context.Background(), filter)
+	return err
+}
+
+// journalInsert records the _id of inserted documents
+// if journaling is enabled.
+func (c *Coll) journalInsert(ids []interface{}) error {
+	if !c.DB.journaling() || len(ids) == 0 {
+		return nil
+	}
+
+	return c.DB.writeJournal(JournalEntry{Op: JournalInsert, DB: c.MongoColl.Database().Name(), Coll: c.CollName, IDs: ids})
+}
+
+// insertedIDs returns the _id of the documents an InsertMany actually inserted.
+// The InsertManyResult has the _id of every document, even if some failed.
+// Since the inserts are ordered, only the documents before the first write error
+// were inserted. For any other error it isn't known which were inserted.
+func insertedIDs(result *mongo.InsertManyResult, err error) []interface{} {
+	if result == nil {
+		return nil
+	}
+
+	if err == nil {
+		return result.InsertedIDs
+	}
+
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok {
+		return nil
+	}
+
+	inserted := len(result.InsertedIDs)
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Index < inserted {
+			inserted = writeErr.Index
+		}
+	}
+
+	return result.InsertedIDs[:inserted]
+}
+
+// journalDelete captures a copy of the documents about to be deleted
+// if journaling is enabled. At most limit documents are captured
+// unless limit is 0.
+// Returns the filter to use for the delete. The filter is restricted to
+// the _id of the captured documents so that only journaled documents are deleted.
+func (c *Coll) journalDelete(filter interface{}, limit int64) (interface{}, error) {
+	if !c.DB.journaling() {
+		return filter, nil
+	}
+
+	findOptions := options.Find()
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+
+	cursor, err := c.MongoColl.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return filter, err
+	}
+
+	docs := []bson.D{}
+	if err = cursor.All(context.Background(), &docs); err != nil || len(docs) == 0 {
+		return filter, err
+	}
+
+	ids := make(bson.A, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.Map()["_id"]
+	}
+
+	err = c.DB.writeJournal(JournalEntry{Op: JournalDelete, DB: c.MongoColl.Database().Name(), Coll: c.CollName, Docs: docs})
+
+	idFilter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	return bson.D{{Key: "$and", Value: bson.A{filter, idFilter}}}, err
+}
+
+// isDuplicateKeyOnly returns true if err is a bulk write error where
+// every write error was a duplicate key error
+func isDuplicateKeyOnly(err error) bool {
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok || bulkErr.WriteConcernError != nil {
+		return false
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// appendJournalFile appends an entry to a journal file
+// as a single line of canonical Extended JSON
+func appendJournalFile(filePath string, entry JournalEntry) error {
+	line, err := bson.MarshalExtJSON(entry, true, false)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// readJournalFile reads all of the entries in a journal file.
+// A missing file is treated as an empty journal.
+func readJournalFile(filePath string) ([]JournalEntry, error) {
+	result := []JournalEntry{}
+
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry JournalEntry
+		if err := bson.UnmarshalExtJSON(line, true, &entry); err != nil {
+			return result, err
+		}
+		result = append(result, entry)
+	}
+
+	return result, scanner.Err()
+}
+
+// writeJournalFile replaces the contents of a journal file
+func writeJournalFile(filePath string, entries []JournalEntry) error {
+	var buf bytes.Buffer
+
+	for _, entry := range entries {
+		line, err := bson.MarshalExtJSON(entry, true, false)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	return ioutil.WriteFile(filePath, buf.Bytes(), 0644)
+}
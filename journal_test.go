@@ -0,0 +1,190 @@
+package mongolang
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestJournalFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongolang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "journal.jsonl")
+
+	// missing file is an empty journal
+	entries, err := readJournalFile(filePath)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected empty journal, got %d entries, error: %v", len(entries), err)
+	}
+
+	oid := primitive.NewObjectID()
+	insertEntry := JournalEntry{Op: JournalInsert, DB: "quickstart", Coll: "testCollection",
+		IDs: []interface{}{oid, "90002"}}
+	deleteEntry := JournalEntry{Op: JournalDelete, DB: "quickstart", Coll: "testCollection",
+		Docs: []bson.D{{{Key: "_id", Value: oid}, {Key: "pop", Value: int32(40629)}}}}
+
+	if err = appendJournalFile(filePath, insertEntry); err != nil {
+		t.Fatalf("appendJournalFile error: %v", err)
+	}
+	if err = appendJournalFile(filePath, deleteEntry); err != nil {
+		t.Fatalf("appendJournalFile error: %v", err)
+	}
+
+	entries, err = readJournalFile(filePath)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 journal entries, got %d, error: %v", len(entries), err)
+	}
+
+	if entries[0].Op != JournalInsert || entries[0].IDs[0] != oid || entries[0].IDs[1] != "90002" {
+		t.Errorf("insert entry not read correctly: %+v", entries[0])
+	}
+
+	if entries[1].Op != JournalDelete || len(entries[1].Docs) != 1 ||
+		entries[1].Docs[0].Map()["pop"] != int32(40629) {
+		t.Errorf("delete entry not read correctly: %+v", entries[1])
+	}
+
+	// rewrite with only the first entry
+	if err = writeJournalFile(filePath, entries[:1]); err != nil {
+		t.Fatalf("writeJournalFile error: %v", err)
+	}
+
+	entries, err = readJournalFile(filePath)
+	if err != nil || len(entries) != 1 || entries[0].Op != JournalInsert {
+		t.Errorf("expected only insert entry after rewrite, got %+v, error: %v", entries, err)
+	}
+}
+
+func TestJournalUndo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongolang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	// Undo without a journal
+	db.Undo(1)
+	if db.Err != ErrNoJournal {
+		t.Errorf("expected ErrNoJournal, got %v", db.Err)
+	}
+
+	db.JournalToFile(filepath.Join(dir, "journal.jsonl"))
+	coll := db.Coll("testCollection")
+	coll.DeleteMany(`{"testCase":"journal"}`)
+
+	coll.InsertMany(`[
+		{"testCase":"journal", "seq":1},
+		{"testCase":"journal", "seq":2},
+		{"testCase":"journal", "seq":3}
+	]`)
+	coll.DeleteOne(`{"testCase":"journal", "seq":2}`)
+	coll.DeleteMany(`{"testCase":"journal"}`)
+
+	if db.Err != nil {
+		t.Fatalf("TestJournalUndo error: %v", db.Err)
+	}
+
+	// undo the DeleteMany
+	undone := db.Undo(1)
+	if undone != 1 || coll.Find(`{"testCase":"journal"}`).Count() != 2 {
+		t.Errorf("expected 2 documents after first undo, error: %v", db.Err)
+	}
+
+	// undo the DeleteOne and the InsertMany
+	undone = db.Undo(2)
+	if undone != 2 || coll.Find(`{"testCase":"journal"}`).Count() != 0 {
+		t.Errorf("expected 0 documents after undoing insert, error: %v", db.Err)
+	}
+
+	if len(db.JournalEntries()) != 0 {
+		t.Errorf("expected empty journal, got %d entries", len(db.JournalEntries()))
+	}
+}
+
+func TestJournalPartialInsertMany(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongolang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(3)})
+	defer server.close()
+	defer db.Disconnect()
+
+	db.JournalToFile(filepath.Join(dir, "journal.jsonl"))
+
+	// _id 2 already exists so only the first two documents are inserted
+	db.Coll("zips").InsertMany(`[{"_id":10},{"_id":11},{"_id":2},{"_id":12}]`)
+	if _, ok := db.Err.(mongo.BulkWriteException); !ok {
+		t.Errorf("expected a BulkWriteException, got %v", db.Err)
+	}
+
+	entries := db.JournalEntries()
+	if len(entries) != 1 || len(entries[0].IDs) != 2 || entries[0].IDs[0] != int32(10) || entries[0].IDs[1] != int32(11) {
+		t.Errorf("expected the 2 inserted documents to be journaled, got %+v", entries)
+	}
+}
+
+func TestJournalUndoAfterUse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongolang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(3)})
+	defer server.close()
+	defer db.Disconnect()
+
+	db.JournalToFile(filepath.Join(dir, "journal.jsonl"))
+
+	// the journal records the collection's Database, not the current one
+	zips := db.Coll("zips")
+	db.Use("other")
+	zips.InsertOne(`{"_id":10}`)
+
+	entries := db.JournalEntries()
+	if len(entries) != 1 || entries[0].DB != "test" {
+		t.Fatalf("expected the insert to be journaled for the test Database, got %+v", entries)
+	}
+
+	if undone := db.Undo(1); undone != 1 || db.Err != nil {
+		t.Errorf("expected the insert to be undone, got %d, error %v", undone, db.Err)
+	}
+
+	if cmd := server.lastCommand("delete"); lookup(cmd, "$db") != "test" {
+		t.Errorf("expected the undo to delete from the test Database, got %v", cmd)
+	}
+
+	if n := zips.CountDocuments(`{"_id":10}`); n != 0 {
+		t.Errorf("expected the inserted document to be deleted, found %d", n)
+	}
+}
+
+func TestJournalFindOneAndDeleteProjection(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(3)})
+	defer server.close()
+	defer db.Disconnect()
+
+	db.JournalToFile(filepath.Join(os.TempDir(), "unused-journal.jsonl"))
+
+	// a projection would journal only part of the deleted document
+	db.Coll("zips").FindOneAndDelete(`{"_id":1}`, `{"projection":{"state":1}}`)
+	if db.Err != ErrJournalProjection || server.commandCount("findAndModify") != 0 {
+		t.Errorf("expected ErrJournalProjection, got %v", db.Err)
+	}
+}
@@ -0,0 +1,597 @@
+package mongolang
+
+/*
+	Offline checks for query filters, update documents and aggregation pipelines
+	which find mistakes before they are sent to the server:
+
+		warnings, err := mongolang.Lint(`[{"$mtach":{"state":"CA"}}]`)
+		// [0].$mtach: unknown aggregation stage $mtach, did you mean $match?
+
+	Lint reports unknown stage and operator names, stages in an invalid or
+	inefficient order, and risky constructs such as $where, unanchored regular
+	expressions and $ne or $nin, which can't use an index selectively.
+
+	Linting can also be turned on for a DB so that the filters, updates and pipelines
+	passed to Find(), Aggregate(), UpdateOne() etc. are checked first:
+
+		db.LintParms = true
+
+	Warnings are added to db.LintWarnings. If any warning is for something the
+	server would reject, the call is not made and db.Err is set to a *LintError.
+	Only the most recent lintMaxWarnings warnings are kept, and db.LintWarnings
+	can be set to nil at any time to clear them.
+*/
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LintWarning is a problem found by Lint.
+// Path locates the problem, such as "[1].$match.price.$gtt" for a pipeline.
+// Invalid is true if the server would reject the filter, update or pipeline.
+type LintWarning struct {
+	Code    string
+	Path    string
+	Message string
+	Invalid bool
+}
+
+// Codes for LintWarning
+const (
+	LintUnknownStage    = "unknown-stage"
+	LintUnknownOperator = "unknown-operator"
+	LintInvalidStage    = "invalid-stage"
+	LintStageOrder      = "stage-order"
+	LintWhere           = "where"
+	LintUnanchoredRegex = "unanchored-regex"
+	LintNegation        = "negation"
+)
+
+// LintError is the error set when linting is enabled and
+// a parm has problems which the server would reject
+type LintError struct {
+	Warnings []LintWarning
+}
+
+// lintLargeCollection is the number of documents at or above which
+// $ne and $nin are reported when linting is enabled for a DB
+const lintLargeCollection = 100000
+
+// lintMaxWarnings is the number of warnings kept in DB.LintWarnings.
+// Once reached, the oldest warning is dropped for each new one.
+const lintMaxWarnings = 1000
+
+var lintStages = []string{
+	"$addFields", "$bucket", "$bucketAuto", "$changeStream", "$changeStreamSplitLargeEvent",
+	"$collStats", "$count", "$currentOp", "$densify", "$documents", "$facet", "$fill",
+	"$geoNear", "$graphLookup", "$group", "$indexStats", "$limit", "$listLocalSessions",
+	"$listSampledQueries", "$listSearchIndexes", "$listSessions", "$lookup", "$match",
+	"$merge", "$out", "$planCacheStats", "$project", "$redact", "$replaceRoot",
+	"$replaceWith", "$sample", "$search", "$searchMeta", "$set", "$setWindowFields",
+	"$shardedDataDistribution", "$skip", "$sort", "$sortByCount", "$unionWith", "$unset",
+	"$unwind", "$vectorSearch",
+}
+
+// stages which must be the first stage in a pipeline
+var lintFirstStages = []string{
+	"$changeStream", "$collStats", "$currentOp", "$documents", "$geoNear", "$indexStats",
+	"$listLocalSessions", "$listSampledQueries", "$listSearchIndexes", "$listSessions",
+	"$planCacheStats", "$search", "$searchMeta", "$shardedDataDistribution", "$vectorSearch",
+}
+
+// stages allowed in an update pipeline
+var lintUpdateStages = []string{
+	"$addFields", "$project", "$replaceRoot", "$replaceWith", "$set", "$unset",
+}
+
+// operators which apply to the document as a whole, such as {"$or":[...]}
+var lintQueryOperators = []string{
+	"$and", "$comment", "$expr", "$jsonSchema", "$nor", "$or", "$sampleRate", "$text", "$where",
+}
+
+// operators which apply to a field, such as {"price":{"$gt":10}}
+var lintFieldOperators = []string{
+	"$all", "$bitsAllClear", "$bitsAllSet", "$bitsAnyClear", "$bitsAnySet", "$elemMatch",
+	"$eq", "$exists", "$geoIntersects", "$geoWithin", "$gt", "$gte", "$in", "$lt", "$lte",
+	"$maxDistance", "$minDistance", "$mod", "$ne", "$near", "$nearSphere", "$nin", "$not",
+	"$options", "$regex", "$size", "$type",
+}
+
+var lintUpdateOperators = []string{
+	"$addToSet", "$bit", "$currentDate", "$inc", "$max", "$min", "$mul", "$pop", "$pull",
+	"$pullAll", "$push", "$rename", "$set", "$setOnInsert", "$unset",
+}
+
+// Lint checks a query filter, update document or aggregation pipeline.
+// A JSON string, bson.D, bson.M, bson.A, []bson.D or *Pipeline may be passed.
+// An array is checked as a pipeline. A document whose first field is an
+// update operator, such as $set, is checked as an update. Any other
+// document is checked as a query filter.
+func Lint(parm interface{}) ([]LintWarning, error) {
+	v, err := verifyParm(parm, bsonDAllowed|bsonMAllowed|bsonAAllowed|bsonDSliceAllowed)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc, ok := lintDoc(v); ok && len(doc) > 0 && lintIsUpdate(doc[0].Key) {
+		return LintUpdate(doc)
+	}
+
+	switch v.(type) {
+	case bson.A, []bson.D:
+		return LintPipeline(v)
+	}
+
+	return LintFilter(v)
+}
+
+// LintFilter checks a query filter
+func LintFilter(filter interface{}) ([]LintWarning, error) {
+	v, err := verifyParm(filter, bsonDAllowed|bsonMAllowed)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{}
+	doc, _ := lintDoc(v)
+	l.filter("", doc, false)
+
+	return l.warnings, nil
+}
+
+// LintUpdate checks an update document or an update pipeline
+func LintUpdate(update interface{}) ([]LintWarning, error) {
+	v, err := verifyParm(update, bsonDAllowed|bsonMAllowed|bsonAAllowed|bsonDSliceAllowed)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{}
+	if doc, ok := lintDoc(v); ok {
+		l.update(doc)
+		return l.warnings, nil
+	}
+
+	stages, err := lintPipelineStages(v)
+	if err != nil {
+		return nil, err
+	}
+	l.pipeline("", stages, lintUpdateStages)
+
+	return l.warnings, nil
+}
+
+// LintPipeline checks an aggregation pipeline
+func LintPipeline(pipeline interface{}) ([]LintWarning, error) {
+	stages, err := lintPipelineStages(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{}
+	l.pipeline("", stages, lintStages)
+
+	return l.warnings, nil
+}
+
+// linter collects the warnings for a parm
+type linter struct {
+	warnings []LintWarning
+}
+
+// warn adds a warning the server would accept
+func (l *linter) warn(code string, path string, format string, a ...interface{}) {
+	l.warnings = append(l.warnings, LintWarning{Code: code, Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// invalid adds a warning for something the server would reject
+func (l *linter) invalid(code string, path string, format string, a ...interface{}) {
+	l.warnings = append(l.warnings, LintWarning{Code: code, Path: path, Message: fmt.Sprintf(format, a...), Invalid: true})
+}
+
+// unknown adds a warning for an unknown stage or operator, suggesting
+// the closest known name when there is one
+func (l *linter) unknown(code string, path string, kind string, name string, known []string) {
+	if suggestion := lintSuggest(name, known); suggestion != "" {
+		l.invalid(code, path, "unknown %s %s, did you mean %s?", kind, name, suggestion)
+	} else {
+		l.invalid(code, path, "unknown %s %s", kind, name)
+	}
+}
+
+// pipeline checks each stage of a pipeline, allowing only the stages in allowed
+func (l *linter) pipeline(path string, stages []bson.D, allowed []string) {
+	var lookupAs string
+	grouped := false
+
+	for i, stage := range stages {
+		stagePath := fmt.Sprintf("%s[%d]", path, i)
+
+		if len(stage) != 1 {
+			l.invalid(LintInvalidStage, stagePath, "a stage must have exactly one field, found %d", len(stage))
+			continue
+		}
+
+		name := stage[0].Key
+		spec := stage[0].Value
+		stagePath = lintPath(stagePath, name)
+
+		if !containsString(allowed, name) {
+			if containsString(lintStages, name) {
+				l.invalid(LintInvalidStage, stagePath, "%s can't be used here", name)
+			} else {
+				l.unknown(LintUnknownStage, stagePath, "aggregation stage", name, allowed)
+			}
+			continue
+		}
+
+		if i > 0 && containsString(lintFirstStages, name) {
+			l.invalid(LintStageOrder, stagePath, "%s must be the first stage", name)
+		}
+
+		if (name == "$out" || name == "$merge") && i < len(stages)-1 {
+			l.invalid(LintStageOrder, stagePath, "%s must be the last stage", name)
+		}
+
+		switch name {
+		case "$match":
+			doc, _ := lintDoc(spec)
+			l.filter(stagePath, doc, true)
+
+			if lookupAs != "" && !lintReferences(doc, lookupAs) {
+				l.warn(LintStageOrder, stagePath,
+					"$match after $lookup doesn't use %q; move it before the $lookup so fewer documents are looked up", lookupAs)
+			}
+
+		case "$sort":
+			if grouped {
+				l.warn(LintStageOrder, stagePath,
+					"$sort after $group can't use an index and sorts in memory; sort before the $group or limit the groups")
+			}
+
+		case "$group":
+			grouped = true
+
+		case "$lookup", "$unionWith", "$graphLookup":
+			if doc, ok := lintDoc(spec); ok {
+				if sub, ok := lintStagesOf(lookup(doc, "pipeline")); ok {
+					l.pipeline(lintPath(stagePath, "pipeline"), sub, lintStages)
+				}
+			}
+
+		case "$facet":
+			doc, _ := lintDoc(spec)
+			for _, facet := range doc {
+				if sub, ok := lintStagesOf(facet.Value); ok {
+					l.pipeline(lintPath(stagePath, facet.Key), sub, lintStages)
+				}
+			}
+		}
+
+		lookupAs = ""
+		if name == "$lookup" {
+			doc, _ := lintDoc(spec)
+			lookupAs, _ = lookup(doc, "as").(string)
+		}
+	}
+}
+
+// filter checks a query filter. The $where operator is not allowed in a $match stage.
+func (l *linter) filter(path string, filter bson.D, inMatch bool) {
+	for _, e := range filter {
+		fieldPath := lintPath(path, e.Key)
+
+		if !strings.HasPrefix(e.Key, "$") {
+			l.field(fieldPath, e.Value)
+			continue
+		}
+
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			a, ok := e.Value.(bson.A)
+			if !ok {
+				l.invalid(LintUnknownOperator, fieldPath, "%s requires an array of filters", e.Key)
+				continue
+			}
+			for i, v := range a {
+				doc, _ := lintDoc(v)
+				l.filter(fmt.Sprintf("%s[%d]", fieldPath, i), doc, inMatch)
+			}
+
+		case "$where":
+			if inMatch {
+				l.invalid(LintWhere, fieldPath, "$where can't be used in a $match stage; use $expr")
+			} else {
+				l.warn(LintWhere, fieldPath, "$where runs JavaScript for every document and can't use an index; use $expr")
+			}
+
+		default:
+			if containsString(lintFieldOperators, e.Key) {
+				l.invalid(LintUnknownOperator, fieldPath, "%s must be applied to a field, such as {field: {%s: ...}}", e.Key, e.Key)
+			} else if !containsString(lintQueryOperators, e.Key) {
+				l.unknown(LintUnknownOperator, fieldPath, "query operator", e.Key, lintQueryOperators)
+			}
+		}
+	}
+}
+
+// field checks the value a field is compared to in a query filter
+func (l *linter) field(path string, value interface{}) {
+	if re, ok := value.(primitive.Regex); ok {
+		l.regex(path, re.Pattern)
+		return
+	}
+
+	doc, ok := lintDoc(value)
+	if !ok || len(doc) == 0 || !strings.HasPrefix(doc[0].Key, "$") {
+		return
+	}
+
+	l.operators(path, doc)
+}
+
+// operators checks field operators such as {"$gt":10,"$lt":20}
+func (l *linter) operators(path string, ops bson.D) {
+	for _, op := range ops {
+		opPath := lintPath(path, op.Key)
+
+		if !strings.HasPrefix(op.Key, "$") {
+			l.invalid(LintUnknownOperator, opPath, "field %s can't be mixed with operators", op.Key)
+			continue
+		}
+
+		if !containsString(lintFieldOperators, op.Key) {
+			l.unknown(LintUnknownOperator, opPath, "query operator", op.Key, lintFieldOperators)
+			continue
+		}
+
+		switch op.Key {
+		case "$ne", "$nin":
+			l.warn(LintNegation, opPath, "%s can't use an index selectively and examines most documents in a large collection", op.Key)
+
+		case "$regex":
+			switch re := op.Value.(type) {
+			case string:
+				l.regex(opPath, re)
+			case primitive.Regex:
+				l.regex(opPath, re.Pattern)
+			}
+
+		case "$not":
+			l.field(opPath, op.Value)
+
+		case "$elemMatch":
+			doc, _ := lintDoc(op.Value)
+			if len(doc) > 0 && containsString(lintFieldOperators, doc[0].Key) {
+				l.operators(opPath, doc)
+			} else {
+				l.filter(opPath, doc, false)
+			}
+		}
+	}
+}
+
+// regex warns if a regular expression isn't anchored to the start of the string
+func (l *linter) regex(path string, pattern string) {
+	if !strings.HasPrefix(pattern, "^") && !strings.HasPrefix(pattern, `\A`) {
+		l.warn(LintUnanchoredRegex, path, "regular expression /%s/ isn't anchored with ^ and scans every index key", pattern)
+	}
+}
+
+// update checks that each field of an update document is an update operator
+func (l *linter) update(update bson.D) {
+	for _, e := range update {
+		if !strings.HasPrefix(e.Key, "$") {
+			l.invalid(LintUnknownOperator, e.Key, "update requires operators such as $set; use ReplaceOne() to replace a document")
+			return
+		}
+
+		if !containsString(lintUpdateOperators, e.Key) {
+			l.unknown(LintUnknownOperator, e.Key, "update operator", e.Key, lintUpdateOperators)
+		}
+	}
+}
+
+// String returns the warning as "path: message"
+func (w LintWarning) String() string {
+	if w.Path == "" {
+		return w.Message
+	}
+	return w.Path + ": " + w.Message
+}
+
+// Error lists the warnings the server would reject
+func (e *LintError) Error() string {
+	msgs := make([]string, len(e.Warnings))
+	for i, w := range e.Warnings {
+		msgs[i] = w.String()
+	}
+	return "lint: " + strings.Join(msgs, "; ")
+}
+
+// verifyLinted verifies a parm, as verifyParm() does, then if linting is enabled
+// for the DB checks it with lint. $ne and $nin are only reported for large collections.
+func (c *Coll) verifyLinted(parm interface{}, allowedTypes uint32, lint func(interface{}) ([]LintWarning, error)) (interface{}, error) {
+	result, err := verifyParm(parm, allowedTypes)
+	if err != nil || !c.DB.LintParms {
+		return result, err
+	}
+
+	warnings, err := lint(result)
+	if err != nil {
+		return result, err
+	}
+
+	var invalid []LintWarning
+	checkedSize, large := false, true
+
+	for _, w := range warnings {
+		if w.Code == LintNegation && !checkedSize {
+			count, err := c.MongoColl.EstimatedDocumentCount(context.Background())
+			checkedSize, large = true, err != nil || count >= lintLargeCollection
+		}
+
+		if w.Code == LintNegation && !large {
+			continue
+		}
+
+		if len(c.DB.LintWarnings) >= lintMaxWarnings {
+			n := copy(c.DB.LintWarnings, c.DB.LintWarnings[len(c.DB.LintWarnings)-lintMaxWarnings+1:])
+			c.DB.LintWarnings = c.DB.LintWarnings[:n]
+		}
+		c.DB.LintWarnings = append(c.DB.LintWarnings, w)
+
+		if w.Invalid {
+			invalid = append(invalid, w)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return result, &LintError{Warnings: invalid}
+	}
+
+	return result, nil
+}
+
+// lintIsUpdate returns true if the first field of a document shows it is an update,
+// either an update operator or a likely typo of one
+func lintIsUpdate(key string) bool {
+	if containsString(lintUpdateOperators, key) {
+		return true
+	}
+
+	return strings.HasPrefix(key, "$") &&
+		!containsString(lintQueryOperators, key) &&
+		!containsString(lintFieldOperators, key) &&
+		lintSuggest(key, lintUpdateOperators) != ""
+}
+
+// lintSuggest returns the known name closest to name, if it is close enough to be a typo
+func lintSuggest(name string, known []string) string {
+	best, bestDist := "", 3
+
+	for _, k := range known {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(k)); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// min3 returns the smallest of three ints
+func min3(a int, b int, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// lintReferences returns true if a filter refers to field or a subfield of it
+func lintReferences(filter bson.D, field string) bool {
+	for _, e := range filter {
+		if e.Key == field || strings.HasPrefix(e.Key, field+".") {
+			return true
+		}
+
+		switch v := e.Value.(type) {
+		case bson.A:
+			for _, sub := range v {
+				if doc, ok := lintDoc(sub); ok && lintReferences(doc, field) {
+					return true
+				}
+			}
+		default:
+			if e.Key == "$expr" && strings.Contains(ShellJSON(v), `"$`+field) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// lintDoc returns a value as a bson.D if it is a document
+func lintDoc(v interface{}) (bson.D, bool) {
+	switch doc := v.(type) {
+	case bson.D:
+		return doc, true
+	case bson.M:
+		d, _ := toBsonD(doc)
+		return d, true
+	}
+	return nil, false
+}
+
+// lintStagesOf returns a value as pipeline stages if it is an array of documents
+func lintStagesOf(v interface{}) ([]bson.D, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	stages, err := lintPipelineStages(v)
+	return stages, err == nil
+}
+
+// lintPipelineStages verifies a pipeline, returning its stages as bson.D
+// whether each stage is a bson.D or bson.M
+func lintPipelineStages(pipeline interface{}) ([]bson.D, error) {
+	v, err := verifyParm(pipeline, bsonAAllowed|bsonDSliceAllowed)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := v.(bson.A)
+	if !ok {
+		return v.([]bson.D), nil
+	}
+
+	stages := make([]bson.D, len(a))
+	for i, stage := range a {
+		if stages[i], ok = lintDoc(stage); !ok {
+			return nil, fmt.Errorf("stage %d is not a document: %T", i, stage)
+		}
+	}
+
+	return stages, nil
+}
+
+// lintPath appends a key to a path
+func lintPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
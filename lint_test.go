@@ -0,0 +1,177 @@
+package mongolang
+
+import (
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLintNamesSorted(t *testing.T) {
+	lists := map[string][]string{
+		"lintStages":          lintStages,
+		"lintFirstStages":     lintFirstStages,
+		"lintUpdateStages":    lintUpdateStages,
+		"lintQueryOperators":  lintQueryOperators,
+		"lintFieldOperators":  lintFieldOperators,
+		"lintUpdateOperators": lintUpdateOperators,
+	}
+
+	for name, list := range lists {
+		if !sort.StringsAreSorted(list) {
+			t.Errorf("%s must be sorted", name)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		parm     interface{}
+		expected []string
+		invalid  bool
+	}{
+		{`{"state":"CA","pop":{"$gt":1000}}`, nil, false},
+		{`[{"$match":{"state":"CA"}},{"$group":{"_id":"$city"}}]`, nil, false},
+		{bson.A{bson.M{"$match": bson.M{"state": "CA"}}, bson.D{{Key: "$limit", Value: 1}}}, nil, false},
+		{`{"$set":{"a":1},"$inc":{"b":1}}`, nil, false},
+
+		{`[{"$mtach":{"state":"CA"}}]`,
+			[]string{"[0].$mtach: unknown aggregation stage $mtach, did you mean $match?"}, true},
+		{NewPipeline().Stage("$gruop", `{"_id":"$state"}`),
+			[]string{"[0].$gruop: unknown aggregation stage $gruop, did you mean $group?"}, true},
+		{bson.A{bson.M{"$mtach": bson.M{}}},
+			[]string{"[0].$mtach: unknown aggregation stage $mtach, did you mean $match?"}, true},
+		{`{"pop":{"$gtt":1000}}`,
+			[]string{"pop.$gtt: unknown query operator $gtt, did you mean $gt?"}, true},
+		{`{"$or":[{"a":1},{"b":{"$inn":[1,2]}}]}`,
+			[]string{"$or[1].b.$inn: unknown query operator $inn, did you mean $in?"}, true},
+		{`{"$gt":{"a":1}}`,
+			[]string{"$gt: $gt must be applied to a field, such as {field: {$gt: ...}}"}, true},
+		{`{"$sett":{"a":1}}`,
+			[]string{"$sett: unknown update operator $sett, did you mean $set?"}, true},
+		{`{"a":1}`,
+			nil, false},
+		{bson.D{{Key: "$set", Value: bson.D{}}, {Key: "a", Value: 1}},
+			[]string{"a: update requires operators such as $set; use ReplaceOne() to replace a document"}, true},
+
+		{`[{"$out":"a"},{"$match":{}}]`,
+			[]string{"[0].$out: $out must be the last stage"}, true},
+		{`[{"$match":{}},{"$geoNear":{}}]`,
+			[]string{"[1].$geoNear: $geoNear must be the first stage"}, true},
+		{`[{"$match":{"a":1,"$where":"this.a"}}]`,
+			[]string{"[0].$match.$where: $where can't be used in a $match stage; use $expr"}, true},
+		{`[{"$facet":{"top":[{"$limt":1}]}}]`,
+			[]string{"[0].$facet.top[0].$limt: unknown aggregation stage $limt, did you mean $limit?"}, true},
+
+		{`[{"$group":{"_id":"$state"}},{"$sort":{"_id":1}}]`,
+			[]string{"[1].$sort: $sort after $group can't use an index and sorts in memory; sort before the $group or limit the groups"}, false},
+		{`[{"$lookup":{"from":"b","localField":"x","foreignField":"y","as":"bs"}},{"$match":{"state":"CA"}}]`,
+			[]string{`[1].$match: $match after $lookup doesn't use "bs"; move it before the $lookup so fewer documents are looked up`}, false},
+		{`[{"$lookup":{"from":"b","localField":"x","foreignField":"y","as":"bs"}},{"$match":{"bs.qty":{"$gt":0}}}]`,
+			nil, false},
+		{`{"$where":"this.a > 1"}`,
+			[]string{"$where: $where runs JavaScript for every document and can't use an index; use $expr"}, false},
+		{`{"name":{"$regex":"smith","$options":"i"},"city":{"$regex":"^San"}}`,
+			[]string{"name.$regex: regular expression /smith/ isn't anchored with ^ and scans every index key"}, false},
+		{`{"name":{"$not":{"$regex":"x"}}}`,
+			[]string{"name.$not.$regex: regular expression /x/ isn't anchored with ^ and scans every index key"}, false},
+		{`{"state":{"$ne":"CA"}}`,
+			[]string{"state.$ne: $ne can't use an index selectively and examines most documents in a large collection"}, false},
+		{`[{"$match":{"items":{"$elemMatch":{"qty":{"$gtt":1}}}}}]`,
+			[]string{"[0].$match.items.$elemMatch.qty.$gtt: unknown query operator $gtt, did you mean $gt?"}, true},
+	}
+
+	for _, test := range tests {
+		warnings, err := Lint(test.parm)
+		if err != nil {
+			t.Errorf("unexpected error for %v: %v", test.parm, err)
+			continue
+		}
+
+		if len(warnings) != len(test.expected) {
+			t.Errorf("expected %d warnings for %v, got %v", len(test.expected), test.parm, warnings)
+			continue
+		}
+
+		for i, w := range warnings {
+			if w.String() != test.expected[i] {
+				t.Errorf("expected %q, got %q", test.expected[i], w.String())
+			}
+			if w.Invalid != test.invalid {
+				t.Errorf("expected invalid %v for %q", test.invalid, w.String())
+			}
+		}
+	}
+
+	if _, err := Lint(`{"a":`); err == nil {
+		t.Errorf("expected an error for invalid JSON")
+	}
+}
+
+func TestLintUpdatePipeline(t *testing.T) {
+	warnings, err := LintUpdate(`[{"$set":{"a":1}},{"$group":{"_id":null}}]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(warnings) != 1 || warnings[0].Code != LintInvalidStage || warnings[0].String() != "[1].$group: $group can't be used here" {
+		t.Errorf("expected $group to be rejected in an update pipeline, got %v", warnings)
+	}
+}
+
+func TestLintParms(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(3)})
+	defer server.close()
+	defer db.Disconnect()
+
+	zips := db.Coll("zips")
+
+	// off by default
+	zips.Find(`{"pop":{"$gtt":1}}`)
+	if db.Err != nil || len(db.LintWarnings) != 0 {
+		t.Errorf("expected no linting, got %v %v", db.Err, db.LintWarnings)
+	}
+
+	db.LintParms = true
+
+	cursor := zips.Aggregate(`[{"$gruop":{"_id":"$state"}}]`)
+	lintErr, ok := db.Err.(*LintError)
+	if !ok || len(lintErr.Warnings) != 1 || lintErr.Warnings[0].Code != LintUnknownStage {
+		t.Errorf("expected a LintError for $gruop, got %v", db.Err)
+	}
+	if cursor.HasNext() || server.commandCount("aggregate") != 0 {
+		t.Errorf("expected the invalid pipeline not to be run")
+	}
+
+	db.LintWarnings = nil
+	docs := zips.Aggregate(`[{"$group":{"_id":"$state","n":{"$sum":1}}},{"$sort":{"_id":1}}]`).ToArray()
+	if db.Err != nil || len(docs) == 0 {
+		t.Errorf("expected warnings not to stop the pipeline, got %v", db.Err)
+	}
+	if len(db.LintWarnings) != 1 || db.LintWarnings[0].Code != LintStageOrder {
+		t.Errorf("expected a stage order warning, got %v", db.LintWarnings)
+	}
+
+	db.LintWarnings = nil
+	docs = zips.Aggregate(bson.A{bson.M{"$match": bson.M{"state": "CA"}}}).ToArray()
+	if db.Err != nil || len(docs) != 2 || len(db.LintWarnings) != 0 {
+		t.Errorf("expected a pipeline of bson.M stages to be run, got %v %v", db.Err, db.LintWarnings)
+	}
+
+	zips.Find(`{"state":{"$ne":"CA"}}`).ToArray()
+	if db.Err != nil || len(db.LintWarnings) != 0 {
+		t.Errorf("expected no $ne warning for a small collection, got %v %v", db.Err, db.LintWarnings)
+	}
+
+	// only the most recent warnings are kept
+	db.LintWarnings = make([]LintWarning, lintMaxWarnings)
+	zips.Find(`{"$where":"this.a"}`)
+	if n := len(db.LintWarnings); n != lintMaxWarnings || db.LintWarnings[n-1].Code != LintWhere {
+		t.Errorf("expected %d warnings ending with the newest, got %d", lintMaxWarnings, n)
+	}
+
+	zips.UpdateOne(`{"_id":1}`, `{"$sett":{"a":1}}`)
+	if _, ok := db.Err.(*LintError); !ok || server.commandCount("update") != 0 {
+		t.Errorf("expected a LintError for $sett, got %v", db.Err)
+	}
+}
@@ -13,6 +13,7 @@ package mongolang
 
 import (
 	"errors"
+	"log"
 
 	"go.mongodb.org/mongo-driver/bson"
 
@@ -29,11 +30,36 @@ type DB struct {
 
 	Database *mongo.Database
 	Name     string
+
+	Journal *Journal
+
+	CaptureQueries  bool
+	CapturedQueries []CapturedQuery
+
+	LintParms    bool
+	LintWarnings []LintWarning
 }
 
 var ErrNotConnected = errors.New("not connected to a MongoDB")
 var ErrNotConnectedDB = errors.New("not connected to a MongoDB Database")
 
+// Logger, if set, logs errors such as a JSON string which can't be parsed.
+// By default nothing is logged, errors are only returned via DB.Err.
+var Logger *log.Logger
+
+// Journal defines where inserts and deletes are recorded
+// so that they can later be undone via DB.Undo().
+// Only one of FilePath or CollName is used.
+type Journal struct {
+	FilePath string
+
+	DBName   string
+	CollName string
+}
+
+var ErrNoJournal = errors.New("journaling has not been enabled for this DB")
+var ErrJournalProjection = errors.New("a projection can't be used while journaling since the whole document is journaled")
+
 // Coll represents a collection
 type Coll struct {
 	DB        *DB
@@ -57,8 +83,33 @@ type Cursor struct {
 
 	AggrPipeline interface{}
 	AggrOptions  options.AggregateOptions
+
+	// Sort(), Skip() and Limit() for an aggregate cursor,
+	// added as stages to the end of the pipeline when it is run
+	aggrSort  bson.D
+	aggrSkip  *int64
+	aggrLimit *int64
 }
 
 var ErrInvalidCursor = errors.New("cursor not linked to a properly established collection")
 var ErrClosedCursor = errors.New("call made to closed cursor for a method that requires an open cursor")
 var ErrNotFindCursor = errors.New("method call requires a Find() cursor")
+var ErrNotAggregateCursor = errors.New("method call requires an Aggregate() cursor")
+var ErrCursorStarted = errors.New("cursor options can't be changed after reading from the cursor has started")
+var ErrOutputPipeline = errors.New("can't count the documents for a pipeline ending with $out or $merge")
+
+// ChangeStream represents a change stream for a Collection or Database
+type ChangeStream struct {
+	DB          *DB
+	MongoStream *mongo.ChangeStream
+	IsClosed    bool
+
+	NextDoc *bson.D
+
+	// resume tokens for the last change returned and the buffered change
+	token     bson.D
+	nextToken bson.D
+}
+
+var ErrInvalidChangeStream = errors.New("change stream not linked to a properly established db")
+var ErrClosedChangeStream = errors.New("call made to closed change stream")
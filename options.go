@@ -0,0 +1,556 @@
+package mongolang
+
+/*
+	Functions to convert options passed as a JSON string, bson.D or bson.M
+	into the options structs used by the MongoDB Go Driver.
+
+	Options use the same names as the MongoDB Shell. For example:
+
+		db.Coll("zips").UpdateOne(`{"_id":"90002"}`, `{"$inc":{"pop":1}}`,
+			`{"upsert":true, "collation":{"locale":"en", "strength":2}}`)
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// optionsParm returns the first of the optional opts parms as a bson.D.
+// If there is no opts parm, or it is nil, returns an empty bson.D.
+func optionsParm(opts []interface{}) (bson.D, error) {
+	if len(opts) == 0 {
+		return bson.D{}, nil
+	}
+
+	parm, err := verifyParm(opts[0], bsonDAllowed|bsonMAllowed)
+	if err != nil {
+		return nil, err
+	}
+
+	return toBsonD(parm)
+}
+
+// toBsonD converts a bson.D or bson.M to a bson.D.
+// Since a bson.M is unordered, its keys are sorted.
+func toBsonD(parm interface{}) (bson.D, error) {
+	switch p := parm.(type) {
+	case bson.D:
+		return p, nil
+	case bson.M:
+		keys := make([]string, 0, len(p))
+		for k := range p {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		result := make(bson.D, 0, len(p))
+		for _, k := range keys {
+			result = append(result, bson.E{Key: k, Value: p[k]})
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("invalid parm type: %T", parm)
+}
+
+// unknownOption returns the error for an unrecognized option
+func unknownOption(opt bson.E) error {
+	return fmt.Errorf("unrecognized option: %s", opt.Key)
+}
+
+// invalidOption returns the error for an option with an invalid value
+func invalidOption(opt bson.E) error {
+	return fmt.Errorf("invalid value for option %s: %v (%T)", opt.Key, opt.Value, opt.Value)
+}
+
+// optBool returns the value of a boolean option
+func optBool(opt bson.E) (bool, error) {
+	b, ok := opt.Value.(bool)
+	if !ok {
+		return false, invalidOption(opt)
+	}
+
+	return b, nil
+}
+
+// optInt64 returns the value of an integer option.
+// JSON numbers may be parsed as int32, int64 or float64.
+func optInt64(opt bson.E) (int64, error) {
+	switch v := opt.Value.(type) {
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	}
+
+	return 0, invalidOption(opt)
+}
+
+// optString returns the value of a string option
+func optString(opt bson.E) (string, error) {
+	s, ok := opt.Value.(string)
+	if !ok {
+		return "", invalidOption(opt)
+	}
+
+	return s, nil
+}
+
+// optDoc returns the value of an option which must be a document
+func optDoc(opt bson.E) (bson.D, error) {
+	doc, err := toBsonD(opt.Value)
+	if err != nil {
+		return nil, invalidOption(opt)
+	}
+
+	return doc, nil
+}
+
+// optOrderedDoc returns the value of an option where the order of the fields
+// matters, such as sort. A bson.M is not allowed since it is unordered.
+func optOrderedDoc(opt bson.E) (bson.D, error) {
+	if _, ok := opt.Value.(bson.M); ok {
+		return nil, fmt.Errorf("option %s must be a bson.D, not a bson.M, since field order matters", opt.Key)
+	}
+
+	return optDoc(opt)
+}
+
+// optHint returns the value of a hint option which
+// is either an index name or an index key document
+func optHint(opt bson.E) (interface{}, error) {
+	if s, ok := opt.Value.(string); ok {
+		return s, nil
+	}
+
+	return optOrderedDoc(opt)
+}
+
+// optMaxTime returns the value of a maxTimeMS option as a time.Duration
+func optMaxTime(opt bson.E) (time.Duration, error) {
+	ms, err := optInt64(opt)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+// optReturnDocument returns the value of a returnDocument option,
+// either "before" or "after"
+func optReturnDocument(opt bson.E) (options.ReturnDocument, error) {
+	s, _ := opt.Value.(string)
+	switch s {
+	case "before":
+		return options.Before, nil
+	case "after":
+		return options.After, nil
+	}
+
+	return options.Before, invalidOption(opt)
+}
+
+// optReturnNewDocument returns the value of the legacy
+// returnNewDocument option as a ReturnDocument
+func optReturnNewDocument(opt bson.E) (options.ReturnDocument, error) {
+	b, err := optBool(opt)
+	if b {
+		return options.After, err
+	}
+
+	return options.Before, err
+}
+
+// optArrayFilters returns the value of an arrayFilters option
+func optArrayFilters(opt bson.E) (*options.ArrayFilters, error) {
+	filters, ok := opt.Value.(bson.A)
+	if !ok {
+		return nil, invalidOption(opt)
+	}
+
+	return &options.ArrayFilters{Filters: []interface{}(filters)}, nil
+}
+
+// optCollation converts a collation option document,
+// such as {"locale":"en", "strength":2}, to an options.Collation.
+func optCollation(opt bson.E) (*options.Collation, error) {
+	doc, err := optDoc(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &options.Collation{}
+	for _, e := range doc {
+		var n int64
+		switch e.Key {
+		case "locale":
+			result.Locale, err = optString(e)
+		case "caseLevel":
+			result.CaseLevel, err = optBool(e)
+		case "caseFirst":
+			result.CaseFirst, err = optString(e)
+		case "strength":
+			n, err = optInt64(e)
+			result.Strength = int(n)
+		case "numericOrdering":
+			result.NumericOrdering, err = optBool(e)
+		case "alternate":
+			result.Alternate, err = optString(e)
+		case "maxVariable":
+			result.MaxVariable, err = optString(e)
+		case "normalization":
+			result.Normalization, err = optBool(e)
+		case "backwards":
+			result.Backwards, err = optBool(e)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// updateOptions converts the optional opts parm for
+// UpdateOne() and UpdateMany() to an options.UpdateOptions.
+func updateOptions(opts []interface{}) (*options.UpdateOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.Update()
+	for _, e := range doc {
+		var b bool
+		switch e.Key {
+		case "upsert":
+			b, err = optBool(e)
+			result.SetUpsert(b)
+		case "bypassDocumentValidation":
+			b, err = optBool(e)
+			result.SetBypassDocumentValidation(b)
+		case "arrayFilters":
+			result.ArrayFilters, err = optArrayFilters(e)
+		case "collation":
+			result.Collation, err = optCollation(e)
+		case "hint":
+			result.Hint, err = optHint(e)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// replaceOptions converts the optional opts parm for
+// ReplaceOne() to an options.ReplaceOptions.
+func replaceOptions(opts []interface{}) (*options.ReplaceOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.Replace()
+	for _, e := range doc {
+		var b bool
+		switch e.Key {
+		case "upsert":
+			b, err = optBool(e)
+			result.SetUpsert(b)
+		case "bypassDocumentValidation":
+			b, err = optBool(e)
+			result.SetBypassDocumentValidation(b)
+		case "collation":
+			result.Collation, err = optCollation(e)
+		case "hint":
+			result.Hint, err = optHint(e)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// findOneAndUpdateOptions converts the optional opts parm for
+// FindOneAndUpdate() to an options.FindOneAndUpdateOptions.
+func findOneAndUpdateOptions(opts []interface{}) (*options.FindOneAndUpdateOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.FindOneAndUpdate()
+	for _, e := range doc {
+		var b bool
+		var rd options.ReturnDocument
+		var d time.Duration
+		switch e.Key {
+		case "sort":
+			result.Sort, err = optOrderedDoc(e)
+		case "projection":
+			result.Projection, err = optDoc(e)
+		case "upsert":
+			b, err = optBool(e)
+			result.SetUpsert(b)
+		case "returnDocument":
+			rd, err = optReturnDocument(e)
+			result.SetReturnDocument(rd)
+		case "returnNewDocument":
+			rd, err = optReturnNewDocument(e)
+			result.SetReturnDocument(rd)
+		case "arrayFilters":
+			result.ArrayFilters, err = optArrayFilters(e)
+		case "collation":
+			result.Collation, err = optCollation(e)
+		case "hint":
+			result.Hint, err = optHint(e)
+		case "maxTimeMS":
+			d, err = optMaxTime(e)
+			result.SetMaxTime(d)
+		case "bypassDocumentValidation":
+			b, err = optBool(e)
+			result.SetBypassDocumentValidation(b)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// findOneAndReplaceOptions converts the optional opts parm for
+// FindOneAndReplace() to an options.FindOneAndReplaceOptions.
+func findOneAndReplaceOptions(opts []interface{}) (*options.FindOneAndReplaceOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.FindOneAndReplace()
+	for _, e := range doc {
+		var b bool
+		var rd options.ReturnDocument
+		var d time.Duration
+		switch e.Key {
+		case "sort":
+			result.Sort, err = optOrderedDoc(e)
+		case "projection":
+			result.Projection, err = optDoc(e)
+		case "upsert":
+			b, err = optBool(e)
+			result.SetUpsert(b)
+		case "returnDocument":
+			rd, err = optReturnDocument(e)
+			result.SetReturnDocument(rd)
+		case "returnNewDocument":
+			rd, err = optReturnNewDocument(e)
+			result.SetReturnDocument(rd)
+		case "collation":
+			result.Collation, err = optCollation(e)
+		case "hint":
+			result.Hint, err = optHint(e)
+		case "maxTimeMS":
+			d, err = optMaxTime(e)
+			result.SetMaxTime(d)
+		case "bypassDocumentValidation":
+			b, err = optBool(e)
+			result.SetBypassDocumentValidation(b)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// findOneAndDeleteOptions converts the optional opts parm for
+// FindOneAndDelete() to an options.FindOneAndDeleteOptions.
+func findOneAndDeleteOptions(opts []interface{}) (*options.FindOneAndDeleteOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.FindOneAndDelete()
+	for _, e := range doc {
+		var d time.Duration
+		switch e.Key {
+		case "sort":
+			result.Sort, err = optOrderedDoc(e)
+		case "projection":
+			result.Projection, err = optDoc(e)
+		case "collation":
+			result.Collation, err = optCollation(e)
+		case "hint":
+			result.Hint, err = optHint(e)
+		case "maxTimeMS":
+			d, err = optMaxTime(e)
+			result.SetMaxTime(d)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// countOptions converts the optional opts parm for
+// CountDocuments() to an options.CountOptions.
+func countOptions(opts []interface{}) (*options.CountOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.Count()
+	for _, e := range doc {
+		var n int64
+		var d time.Duration
+		switch e.Key {
+		case "skip":
+			n, err = optInt64(e)
+			result.SetSkip(n)
+		case "limit":
+			n, err = optInt64(e)
+			result.SetLimit(n)
+		case "collation":
+			result.Collation, err = optCollation(e)
+		case "hint":
+			result.Hint, err = optHint(e)
+		case "maxTimeMS":
+			d, err = optMaxTime(e)
+			result.SetMaxTime(d)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// estimatedCountOptions converts the optional opts parm for
+// EstimatedDocumentCount() to an options.EstimatedDocumentCountOptions.
+func estimatedCountOptions(opts []interface{}) (*options.EstimatedDocumentCountOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.EstimatedDocumentCount()
+	for _, e := range doc {
+		var d time.Duration
+		switch e.Key {
+		case "maxTimeMS":
+			d, err = optMaxTime(e)
+			result.SetMaxTime(d)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// aggregateOptions converts the optional opts parm for
+// Aggregate() to an options.AggregateOptions.
+// The batch size may be given as batchSize or, as in the MongoDB Shell,
+// as cursor: {batchSize: n}.
+func aggregateOptions(opts []interface{}) (*options.AggregateOptions, error) {
+	doc, err := optionsParm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := options.Aggregate()
+	for _, e := range doc {
+		var b bool
+		var n int64
+		var s string
+		var d time.Duration
+		var cursor bson.D
+		switch e.Key {
+		case "allowDiskUse":
+			b, err = optBool(e)
+			result.SetAllowDiskUse(b)
+		case "batchSize":
+			n, err = optInt64(e)
+			result.SetBatchSize(int32(n))
+		case "cursor":
+			cursor, err = optDoc(e)
+			for _, c := range cursor {
+				if err != nil {
+					break
+				}
+				if c.Key != "batchSize" {
+					err = unknownOption(c)
+					break
+				}
+				n, err = optInt64(c)
+				result.SetBatchSize(int32(n))
+			}
+		case "maxTimeMS":
+			d, err = optMaxTime(e)
+			result.SetMaxTime(d)
+		case "collation":
+			result.Collation, err = optCollation(e)
+		case "hint":
+			result.Hint, err = optHint(e)
+		case "comment":
+			s, err = optString(e)
+			result.SetComment(s)
+		case "let":
+			result.Let, err = optDoc(e)
+		case "bypassDocumentValidation":
+			b, err = optBool(e)
+			result.SetBypassDocumentValidation(b)
+		default:
+			err = unknownOption(e)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
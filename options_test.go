@@ -0,0 +1,144 @@
+package mongolang
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestUpdateOptions(t *testing.T) {
+	opts, err := updateOptions([]interface{}{`{
+		"upsert": true,
+		"arrayFilters": [{"elem.grade":{"$gte":85}}],
+		"collation": {"locale":"en", "strength":2, "caseLevel":true},
+		"hint": {"state":1}
+	}`})
+
+	if err != nil {
+		t.Fatalf("updateOptions error: %v", err)
+	}
+
+	if opts.Upsert == nil || !*opts.Upsert {
+		t.Error("expected upsert option to be set")
+	}
+
+	if opts.ArrayFilters == nil || len(opts.ArrayFilters.Filters) != 1 {
+		t.Errorf("expected 1 array filter, got %+v", opts.ArrayFilters)
+	}
+
+	if opts.Collation == nil || opts.Collation.Locale != "en" ||
+		opts.Collation.Strength != 2 || !opts.Collation.CaseLevel {
+		t.Errorf("collation not set correctly: %+v", opts.Collation)
+	}
+
+	if _, ok := opts.Hint.(bson.D); !ok {
+		t.Errorf("expected bson.D hint, got %T", opts.Hint)
+	}
+
+	// no options
+	opts, err = updateOptions(nil)
+	if err != nil || opts.Upsert != nil {
+		t.Errorf("expected empty options, got %+v, error: %v", opts, err)
+	}
+
+	// bson.M options and a hint by name
+	opts, err = updateOptions([]interface{}{bson.M{"hint": "state_1"}})
+	if err != nil || opts.Hint != "state_1" {
+		t.Errorf("expected hint state_1, got %v, error: %v", opts.Hint, err)
+	}
+
+	// invalid options
+	invalid := []string{
+		`{"upsert":"yes"}`,
+		`{"upsrt":true}`,
+		`{"arrayFilters":{"elem":1}}`,
+		`{"collation":{"locale":"en", "strength":"2"}}`,
+		`{"collation":{"lcale":"en"}}`,
+		`{"hint":1}`,
+	}
+
+	for _, s := range invalid {
+		if _, err = updateOptions([]interface{}{s}); err == nil {
+			t.Errorf("expected error for update options %s", s)
+		}
+	}
+
+	// arrayFilters are not a replace option
+	if _, err = replaceOptions([]interface{}{`{"arrayFilters":[]}`}); err == nil {
+		t.Error("expected error for replace option arrayFilters")
+	}
+}
+
+func TestFindOneAndModifyOptions(t *testing.T) {
+	updateOpts, err := findOneAndUpdateOptions([]interface{}{
+		`{"sort":{"pop":-1}, "projection":{"loc":0}, "upsert":true, "returnDocument":"after", "maxTimeMS":500}`})
+
+	if err != nil {
+		t.Fatalf("findOneAndUpdateOptions error: %v", err)
+	}
+
+	if updateOpts.ReturnDocument == nil || *updateOpts.ReturnDocument != options.After {
+		t.Errorf("expected returnDocument after, got %v", updateOpts.ReturnDocument)
+	}
+
+	if updateOpts.MaxTime == nil || *updateOpts.MaxTime != 500*time.Millisecond {
+		t.Errorf("expected maxTime of 500ms, got %v", updateOpts.MaxTime)
+	}
+
+	replaceOpts, err := findOneAndReplaceOptions([]interface{}{`{"returnNewDocument":true}`})
+	if err != nil || replaceOpts.ReturnDocument == nil || *replaceOpts.ReturnDocument != options.After {
+		t.Errorf("expected returnNewDocument to set returnDocument after, error: %v", err)
+	}
+
+	if _, err = findOneAndUpdateOptions([]interface{}{`{"returnDocument":"new"}`}); err == nil {
+		t.Error("expected error for returnDocument new")
+	}
+
+	if _, err = findOneAndDeleteOptions([]interface{}{`{"upsert":true}`}); err == nil {
+		t.Error("expected error for delete option upsert")
+	}
+
+	// a bson.M would lose the field order
+	for _, opt := range []string{"sort", "hint"} {
+		opts := bson.D{{Key: opt, Value: bson.M{"pop": -1, "city": 1}}}
+		if _, err = findOneAndDeleteOptions([]interface{}{opts}); err == nil {
+			t.Errorf("expected error for a bson.M %s", opt)
+		}
+	}
+}
+
+func TestAggregateOptions(t *testing.T) {
+	opts, err := aggregateOptions([]interface{}{`{
+		"allowDiskUse": true,
+		"cursor": {"batchSize": 50},
+		"maxTimeMS": 1000,
+		"collation": {"locale":"fr"},
+		"hint": "state_1",
+		"comment": "report",
+		"let": {"minPop": 1000},
+		"bypassDocumentValidation": true
+	}`})
+
+	if err != nil {
+		t.Fatalf("aggregateOptions error: %v", err)
+	}
+
+	if !*opts.AllowDiskUse || *opts.BatchSize != 50 || *opts.MaxTime != time.Second ||
+		opts.Collation.Locale != "fr" || opts.Hint != "state_1" || *opts.Comment != "report" ||
+		!*opts.BypassDocumentValidation {
+		t.Errorf("aggregate options not set correctly: %+v", opts)
+	}
+
+	if let, ok := opts.Let.(bson.D); !ok || let[0].Key != "minPop" {
+		t.Errorf("expected let document, got %v", opts.Let)
+	}
+
+	invalid := []string{`{"batchSize":"10"}`, `{"cursor":{"size":10}}`, `{"let":5}`, `{"explain":true}`}
+	for _, opt := range invalid {
+		if _, err = aggregateOptions([]interface{}{opt}); err == nil {
+			t.Errorf("expected error for %s", opt)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package mongolang
+
+/*
+	A builder for aggregation pipelines, as an alternative to a JSON string:
+
+		p := mongolang.NewPipeline().
+			Match(`{"state":"CA"}`).
+			Group(`{"_id":"$city","pop":{"$sum":"$pop"}}`).
+			Sort(`{"pop":-1}`).
+			Limit(5)
+
+		db.Coll("zips").Aggregate(p).Pretty()
+		p.Print()
+
+	Each stage method accepts a JSON string, bson.D or bson.M. The first invalid
+	stage is recorded in Err and reported when the Pipeline is passed to Aggregate().
+	Print() and String() show the pipeline in MongoDB Shell syntax,
+	one stage per line, ready to paste into mongosh.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Pipeline is an aggregation pipeline being built.
+// Err is the error for the first invalid stage, if any.
+type Pipeline struct {
+	Stages []bson.D
+	Err    error
+}
+
+// NewPipeline returns an empty Pipeline
+func NewPipeline() *Pipeline {
+	return &Pipeline{Stages: []bson.D{}}
+}
+
+// Stage adds any stage, such as Stage("$sample", `{"size":10}`),
+// for stages which don't have their own method.
+func (p *Pipeline) Stage(name string, spec interface{}) *Pipeline {
+	return p.addStage(name, spec, bsonDAllowed|bsonMAllowed)
+}
+
+// Match adds a $match stage with a query filter
+func (p *Pipeline) Match(filter interface{}) *Pipeline {
+	return p.addStage("$match", filter, bsonDAllowed|bsonMAllowed)
+}
+
+// Project adds a $project stage
+func (p *Pipeline) Project(projection interface{}) *Pipeline {
+	return p.addStage("$project", projection, bsonDAllowed|bsonMAllowed)
+}
+
+// AddFields adds an $addFields stage
+func (p *Pipeline) AddFields(fields interface{}) *Pipeline {
+	return p.addStage("$addFields", fields, bsonDAllowed|bsonMAllowed)
+}
+
+// Group adds a $group stage, such as `{"_id":"$state","total":{"$sum":1}}`
+func (p *Pipeline) Group(group interface{}) *Pipeline {
+	return p.addStage("$group", group, bsonDAllowed|bsonMAllowed)
+}
+
+// Sort adds a $sort stage given a JSON string or bson.D.
+// A bson.M is not allowed since sort order is significant.
+func (p *Pipeline) Sort(sortSequence interface{}) *Pipeline {
+	return p.addStage("$sort", sortSequence, bsonDAllowed)
+}
+
+// Limit adds a $limit stage
+func (p *Pipeline) Limit(n int64) *Pipeline {
+	return p.add(bson.D{{Key: "$limit", Value: n}})
+}
+
+// Skip adds a $skip stage
+func (p *Pipeline) Skip(n int64) *Pipeline {
+	return p.add(bson.D{{Key: "$skip", Value: n}})
+}
+
+// Unwind adds an $unwind stage given either a field path, such as "$sizes",
+// or a document with options such as `{"path":"$sizes","preserveNullAndEmptyArrays":true}`
+func (p *Pipeline) Unwind(pathOrOptions interface{}) *Pipeline {
+	if path, ok := pathOrOptions.(string); ok && !strings.HasPrefix(strings.TrimSpace(path), "{") {
+		return p.add(bson.D{{Key: "$unwind", Value: path}})
+	}
+
+	return p.addStage("$unwind", pathOrOptions, bsonDAllowed|bsonMAllowed)
+}
+
+// Lookup adds a $lookup stage, such as
+// `{"from":"inventory","localField":"item","foreignField":"sku","as":"stock"}`
+func (p *Pipeline) Lookup(lookup interface{}) *Pipeline {
+	return p.addStage("$lookup", lookup, bsonDAllowed|bsonMAllowed)
+}
+
+// Facet adds a $facet stage. Each facet's pipeline may itself be built
+// with a Pipeline, using its Stages, for example
+// bson.D{{Key: "top", Value: NewPipeline().Sort(`{"pop":-1}`).Limit(3).Stages}}.
+func (p *Pipeline) Facet(facets interface{}) *Pipeline {
+	return p.addStage("$facet", facets, bsonDAllowed|bsonMAllowed)
+}
+
+// Bucket adds a $bucket stage
+func (p *Pipeline) Bucket(bucket interface{}) *Pipeline {
+	return p.addStage("$bucket", bucket, bsonDAllowed|bsonMAllowed)
+}
+
+// SetWindowFields adds a $setWindowFields stage. Requires MongoDB 5.0 or later.
+func (p *Pipeline) SetWindowFields(windowFields interface{}) *Pipeline {
+	return p.addStage("$setWindowFields", windowFields, bsonDAllowed|bsonMAllowed)
+}
+
+// Count adds a $count stage which outputs a document with the count in field
+func (p *Pipeline) Count(field string) *Pipeline {
+	return p.add(bson.D{{Key: "$count", Value: field}})
+}
+
+// Out adds an $out stage given either a collection name or
+// a document such as `{"db":"reports","coll":"popByState"}`
+func (p *Pipeline) Out(collOrOptions interface{}) *Pipeline {
+	if coll, ok := collOrOptions.(string); ok && !strings.HasPrefix(strings.TrimSpace(coll), "{") {
+		return p.add(bson.D{{Key: "$out", Value: coll}})
+	}
+
+	return p.addStage("$out", collOrOptions, bsonDAllowed|bsonMAllowed)
+}
+
+// Merge adds a $merge stage given either a collection name or
+// a document such as `{"into":"popByState","whenMatched":"replace"}`
+func (p *Pipeline) Merge(collOrOptions interface{}) *Pipeline {
+	if coll, ok := collOrOptions.(string); ok && !strings.HasPrefix(strings.TrimSpace(coll), "{") {
+		return p.add(bson.D{{Key: "$merge", Value: coll}})
+	}
+
+	return p.addStage("$merge", collOrOptions, bsonDAllowed|bsonMAllowed)
+}
+
+// addStage verifies the spec for a stage then adds the stage.
+// A bson.M spec is converted to a bson.D.
+func (p *Pipeline) addStage(name string, spec interface{}, allowedTypes uint32) *Pipeline {
+	parm, err := verifyParm(spec, allowedTypes)
+	if err == nil {
+		parm, err = toBsonD(parm)
+	}
+
+	if err != nil {
+		if p.Err == nil {
+			p.Err = fmt.Errorf("stage %d (%s): %w", len(p.Stages)+1, name, err)
+		}
+		return p
+	}
+
+	return p.add(bson.D{{Key: name, Value: parm}})
+}
+
+// add adds a stage to the end of the pipeline
+func (p *Pipeline) add(stage bson.D) *Pipeline {
+	p.Stages = append(p.Stages, stage)
+	return p
+}
+
+// String returns the pipeline in MongoDB Shell syntax, one stage per line
+func (p *Pipeline) String() string {
+	if len(p.Stages) == 0 {
+		return "[]"
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString("[\n")
+	for i, stage := range p.Stages {
+		buf.WriteString("  ")
+		writeShellJSON(&buf, stage)
+		if i < len(p.Stages)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]")
+
+	return buf.String()
+}
+
+// Print prints the pipeline in MongoDB Shell syntax
+func (p *Pipeline) Print() {
+	fmt.Println(p.String())
+}
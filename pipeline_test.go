@@ -0,0 +1,103 @@
+package mongolang
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPipeline(t *testing.T) {
+	p := NewPipeline().
+		Match(`{"state":"CA"}`).
+		Project(bson.M{"city": 1, "pop": 1}).
+		AddFields(`{"big":{"$gt":["$pop",10000]}}`).
+		Unwind("$tags").
+		Unwind(`{"path":"$sizes","preserveNullAndEmptyArrays":true}`).
+		Lookup(`{"from":"inventory","localField":"item","foreignField":"sku","as":"stock"}`).
+		Group(`{"_id":"$city","pop":{"$sum":"$pop"}}`).
+		Sort(`{"pop":-1}`).
+		Skip(1).
+		Limit(5).
+		Facet(bson.D{{Key: "top", Value: NewPipeline().Limit(3).Stages}}).
+		Bucket(`{"groupBy":"$pop","boundaries":[0,1000]}`).
+		SetWindowFields(`{"sortBy":{"pop":1},"output":{"n":{"$documentNumber":{}}}}`).
+		Stage("$sample", `{"size":2}`).
+		Count("n").
+		Out("results").
+		Merge(`{"into":"merged","whenMatched":"replace"}`)
+
+	if p.Err != nil {
+		t.Fatalf("unexpected pipeline error: %v", p.Err)
+	}
+
+	names := []string{}
+	for _, stage := range p.Stages {
+		names = append(names, stage[0].Key)
+	}
+
+	expected := "[$match $project $addFields $unwind $unwind $lookup $group $sort $skip $limit $facet $bucket $setWindowFields $sample $count $out $merge]"
+	if fmt.Sprint(names) != expected {
+		t.Errorf("expected stages %s, got %v", expected, names)
+	}
+
+	// a pipeline is accepted anywhere a []bson.D pipeline is
+	stages, err := verifyParm(p, bsonAAllowed|bsonDSliceAllowed)
+	if _, ok := stages.([]bson.D); !ok || err != nil {
+		t.Errorf("verifyParm returned %T, error: %v", stages, err)
+	}
+
+	// the first invalid stage is reported
+	p = NewPipeline().Match(`{"state":}`).Sort(5).Limit(1)
+	if p.Err == nil || len(p.Stages) != 1 {
+		t.Errorf("expected error for invalid stage, stages: %v", p.Stages)
+	}
+
+	if _, err = verifyParm(p, bsonAAllowed|bsonDSliceAllowed); err != p.Err {
+		t.Errorf("expected verifyParm error %v, got %v", p.Err, err)
+	}
+
+	// a bson.M would lose the sort order
+	p = NewPipeline().Sort(bson.M{"pop": -1, "city": 1})
+	if p.Err == nil {
+		t.Errorf("expected error for a bson.M sort, stages: %v", p.Stages)
+	}
+}
+
+func TestPipelineString(t *testing.T) {
+	p := NewPipeline().
+		Match(`{"state":"CA","pop":{"$gte":1000}}`).
+		Group(`{"_id":"$city","total pop":{"$sum":"$pop"}}`).
+		Limit(5)
+
+	expected := `[
+  { $match: { state: "CA", pop: { $gte: 1000 } } },
+  { $group: { _id: "$city", "total pop": { $sum: "$pop" } } },
+  { $limit: 5 }
+]`
+	if p.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, p.String())
+	}
+
+	if NewPipeline().String() != "[]" {
+		t.Errorf("expected [] for an empty pipeline, got %s", NewPipeline())
+	}
+}
+
+func TestPipelineAggregate(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(10)})
+	defer server.close()
+	defer db.Disconnect()
+
+	p := NewPipeline().Match(`{"state":"NV"}`).Sort(`{"_id":-1}`).Limit(2)
+	ids := testIDs(db.Coll("zips").Aggregate(p).ToArray())
+
+	if db.Err != nil || fmt.Sprint(ids) != "[10 8]" {
+		t.Errorf("expected [10 8], got %v, error: %v", ids, db.Err)
+	}
+
+	db.Coll("zips").Aggregate(NewPipeline().Match(5))
+	if db.Err == nil {
+		t.Error("expected error from Aggregate() for an invalid pipeline")
+	}
+}
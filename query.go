@@ -0,0 +1,278 @@
+package mongolang
+
+/*
+	A builder for query filters, as an alternative to a JSON string:
+
+		q := mongolang.Q().Eq("state", "CA").Gt("pop", 1000).Lt("pop", 5000)
+		db.Coll("zips").Find(q).Pretty()
+
+		q.Print()
+		// { state: "CA", pop: { $gt: 1000, $lt: 5000 } }
+
+	A Query can be passed anywhere a filter can, including Pipeline.Match().
+	Conditions on the same field are combined, as in the example above.
+	Or(), And() and Nor() accept other Queries, JSON strings, bson.D or bson.M.
+	The first invalid condition is recorded in Err and reported when the Query is used.
+*/
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Query is a query filter being built.
+// Err is the error for the first invalid condition, if any.
+type Query struct {
+	Filter bson.D
+	Err    error
+}
+
+// Q returns an empty Query, which matches every document
+func Q() *Query {
+	return &Query{Filter: bson.D{}}
+}
+
+// Eq matches documents where field equals value
+func (q *Query) Eq(field string, value interface{}) *Query {
+	for _, e := range q.Filter {
+		if e.Key == field {
+			return q.Op(field, "$eq", value)
+		}
+	}
+
+	q.Filter = append(q.Filter, bson.E{Key: field, Value: value})
+	return q
+}
+
+// Ne matches documents where field does not equal value
+func (q *Query) Ne(field string, value interface{}) *Query {
+	return q.Op(field, "$ne", value)
+}
+
+// Gt matches documents where field is greater than value
+func (q *Query) Gt(field string, value interface{}) *Query {
+	return q.Op(field, "$gt", value)
+}
+
+// Gte matches documents where field is greater than or equal to value
+func (q *Query) Gte(field string, value interface{}) *Query {
+	return q.Op(field, "$gte", value)
+}
+
+// Lt matches documents where field is less than value
+func (q *Query) Lt(field string, value interface{}) *Query {
+	return q.Op(field, "$lt", value)
+}
+
+// Lte matches documents where field is less than or equal to value
+func (q *Query) Lte(field string, value interface{}) *Query {
+	return q.Op(field, "$lte", value)
+}
+
+// In matches documents where field equals any of the values
+func (q *Query) In(field string, values ...interface{}) *Query {
+	return q.Op(field, "$in", bson.A(values))
+}
+
+// Nin matches documents where field equals none of the values
+func (q *Query) Nin(field string, values ...interface{}) *Query {
+	return q.Op(field, "$nin", bson.A(values))
+}
+
+// All matches documents where the array field contains all of the values
+func (q *Query) All(field string, values ...interface{}) *Query {
+	return q.Op(field, "$all", bson.A(values))
+}
+
+// Size matches documents where the array field has n elements
+func (q *Query) Size(field string, n int) *Query {
+	return q.Op(field, "$size", n)
+}
+
+// Exists matches documents which have the field, or if exists is false, don't have it
+func (q *Query) Exists(field string, exists bool) *Query {
+	return q.Op(field, "$exists", exists)
+}
+
+// Type matches documents where field is of a BSON type, such as "string" or "date"
+func (q *Query) Type(field string, bsonType interface{}) *Query {
+	return q.Op(field, "$type", bsonType)
+}
+
+// Regex matches documents where field matches a regular expression,
+// with optional options such as "i" for case insensitive
+func (q *Query) Regex(field string, pattern string, options ...string) *Query {
+	re := primitive.Regex{Pattern: pattern}
+	if len(options) > 0 {
+		re.Options = options[0]
+	}
+
+	return q.Op(field, "$regex", re)
+}
+
+// ElemMatch matches documents where an element of the array field matches
+// the condition, such as Q().Gte("qty", 10).Lt("qty", 20) or `{"$gte":80}`
+func (q *Query) ElemMatch(field string, condition interface{}) *Query {
+	doc, err := q.doc(condition)
+	if err != nil {
+		return q.fail("$elemMatch", err)
+	}
+
+	return q.Op(field, "$elemMatch", doc)
+}
+
+// Not matches documents where field does not match the operator
+// condition, such as Not("price", Q().Gt("price", 1.99)) or `{"$gt":1.99}`.
+// If a Query is passed, the operators on field are used.
+func (q *Query) Not(field string, condition interface{}) *Query {
+	if sub, ok := condition.(*Query); ok && sub.Err == nil {
+		for _, e := range sub.Filter {
+			if e.Key == field {
+				condition = e.Value
+			}
+		}
+	}
+
+	doc, err := q.doc(condition)
+	if err != nil {
+		return q.fail("$not", err)
+	}
+
+	return q.Op(field, "$not", doc)
+}
+
+// Or matches documents which match any of the conditions
+func (q *Query) Or(conditions ...interface{}) *Query {
+	return q.logical("$or", conditions)
+}
+
+// And matches documents which match all of the conditions
+func (q *Query) And(conditions ...interface{}) *Query {
+	return q.logical("$and", conditions)
+}
+
+// Nor matches documents which match none of the conditions
+func (q *Query) Nor(conditions ...interface{}) *Query {
+	return q.logical("$nor", conditions)
+}
+
+// Expr matches documents using an aggregation expression,
+// such as `{"$gt":["$spent","$budget"]}`
+func (q *Query) Expr(expression interface{}) *Query {
+	doc, err := q.doc(expression)
+	if err != nil {
+		return q.fail("$expr", err)
+	}
+
+	q.Filter = append(q.Filter, bson.E{Key: "$expr", Value: doc})
+	return q
+}
+
+// Op adds a condition using any query operator, such as Op("loc", "$geoWithin", ...),
+// combining it with other conditions on the same field.
+// If the field already has a condition with the operator, both are added within an $and.
+func (q *Query) Op(field string, operator string, value interface{}) *Query {
+	cond := bson.E{Key: operator, Value: value}
+
+	for i, e := range q.Filter {
+		if e.Key != field {
+			continue
+		}
+
+		ops, isOps := e.Value.(bson.D)
+		switch {
+		case isOps && isOperatorDoc(ops) && !hasField(ops, operator):
+			q.Filter[i].Value = append(ops, cond)
+		case !(isOps && isOperatorDoc(ops)) && operator != "$eq":
+			q.Filter[i].Value = bson.D{{Key: "$eq", Value: e.Value}, cond}
+		default:
+			return q.And(bson.D{{Key: field, Value: bson.D{cond}}})
+		}
+		return q
+	}
+
+	q.Filter = append(q.Filter, bson.E{Key: field, Value: bson.D{cond}})
+	return q
+}
+
+// logical adds an $or, $and or $nor condition. A second $or or $nor
+// is added within an $and since a filter can't repeat a field.
+func (q *Query) logical(operator string, conditions []interface{}) *Query {
+	a := bson.A{}
+	for _, c := range conditions {
+		doc, err := q.doc(c)
+		if err != nil {
+			return q.fail(operator, err)
+		}
+		a = append(a, doc)
+	}
+
+	for i, e := range q.Filter {
+		if e.Key != operator && e.Key != "$and" {
+			continue
+		}
+
+		existing, _ := e.Value.(bson.A)
+		if operator == "$and" {
+			q.Filter[i].Value = append(existing, a...)
+			return q
+		}
+
+		if e.Key == operator {
+			return q.And(bson.D{{Key: operator, Value: a}})
+		}
+	}
+
+	q.Filter = append(q.Filter, bson.E{Key: operator, Value: a})
+	return q
+}
+
+// doc verifies a condition, returning it as a bson.D
+func (q *Query) doc(condition interface{}) (bson.D, error) {
+	parm, err := verifyParm(condition, bsonDAllowed|bsonMAllowed)
+	if err != nil {
+		return nil, err
+	}
+
+	return toBsonD(parm)
+}
+
+// fail records the first error
+func (q *Query) fail(operator string, err error) *Query {
+	if q.Err == nil {
+		q.Err = fmt.Errorf("%s: %w", operator, err)
+	}
+	return q
+}
+
+// D returns the filter
+func (q *Query) D() bson.D {
+	return q.Filter
+}
+
+// String returns the filter in MongoDB Shell syntax
+func (q *Query) String() string {
+	return ShellJSON(q.Filter)
+}
+
+// Print prints the filter in MongoDB Shell syntax
+func (q *Query) Print() {
+	fmt.Println(q.String())
+}
+
+// isOperatorDoc returns true if the document is query operators, such as {"$gt":1}
+func isOperatorDoc(doc bson.D) bool {
+	return len(doc) > 0 && len(doc[0].Key) > 0 && doc[0].Key[0] == '$'
+}
+
+// hasField returns true if the document has the field
+func hasField(doc bson.D, key string) bool {
+	for _, e := range doc {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
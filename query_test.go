@@ -0,0 +1,101 @@
+package mongolang
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		query    *Query
+		expected string
+	}{
+		{Q(), "{}"},
+		{Q().Eq("state", "CA").Gt("pop", 1000).Lt("pop", 5000),
+			`{ state: "CA", pop: { $gt: 1000, $lt: 5000 } }`},
+		{Q().In("city", "FRESNO", "DAVIS").Nin("_id", 1, 2),
+			`{ city: { $in: [ "FRESNO", "DAVIS" ] }, _id: { $nin: [ 1, 2 ] } }`},
+		{Q().Eq("state", "CA").Ne("state", "NV"),
+			`{ state: { $eq: "CA", $ne: "NV" } }`},
+		{Q().Eq("state", "CA").Eq("state", "NV"),
+			`{ state: "CA", $and: [ { state: { $eq: "NV" } } ] }`},
+		{Q().Gt("pop", 1).Gt("pop", 2),
+			`{ pop: { $gt: 1 }, $and: [ { pop: { $gt: 2 } } ] }`},
+		{Q().Regex("city", "^SAN", "i").Exists("loc", true).Type("zip", "string"),
+			`{ city: { $regex: /^SAN/i }, loc: { $exists: true }, zip: { $type: "string" } }`},
+		{Q().Size("tags", 2).All("tags", "a", "b"),
+			`{ tags: { $size: 2, $all: [ "a", "b" ] } }`},
+		{Q().ElemMatch("results", Q().Gte("score", 80).Lt("score", 85)),
+			`{ results: { $elemMatch: { score: { $gte: 80, $lt: 85 } } } }`},
+		{Q().ElemMatch("scores", `{"$gte":80}`),
+			`{ scores: { $elemMatch: { $gte: 80 } } }`},
+		{Q().Not("price", Q().Gt("price", 1.99)),
+			`{ price: { $not: { $gt: 1.99 } } }`},
+		{Q().Or(Q().Eq("state", "CA"), `{"pop":{"$lt":100}}`),
+			`{ $or: [ { state: "CA" }, { pop: { $lt: 100 } } ] }`},
+		{Q().Or(Q().Eq("a", 1), Q().Eq("b", 1)).Or(Q().Eq("c", 1), Q().Eq("d", 1)),
+			`{ $or: [ { a: 1 }, { b: 1 } ], $and: [ { $or: [ { c: 1 }, { d: 1 } ] } ] }`},
+		{Q().And(bson.D{{Key: "a", Value: 1}}).And(bson.M{"b": 2}).Nor(Q().Eq("c", 3)),
+			`{ $and: [ { a: 1 }, { b: 2 } ], $nor: [ { c: 3 } ] }`},
+		{Q().Expr(`{"$gt":["$spent","$budget"]}`),
+			`{ $expr: { $gt: [ "$spent", "$budget" ] } }`},
+		{Q().Op("loc", "$near", bson.D{{Key: "$maxDistance", Value: 10}}),
+			`{ loc: { $near: { $maxDistance: 10 } } }`},
+	}
+
+	for _, test := range tests {
+		if test.query.Err != nil {
+			t.Errorf("unexpected error %v for %s", test.query.Err, test.expected)
+		}
+		if got := test.query.String(); got != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, got)
+		}
+	}
+
+	q := Q().Eq("a", 1).Or(`{"b":`).ElemMatch("c", `[1]`)
+	if q.Err == nil || q.Err.Error()[:4] != "$or:" {
+		t.Errorf("expected the first error to be for $or, got %v", q.Err)
+	}
+
+	if _, err := verifyParm(q, bsonDAllowed|bsonMAllowed); err != q.Err {
+		t.Errorf("expected verifyParm to return the Query error, got %v", err)
+	}
+
+	parm, err := verifyParm(Q().Eq("a", 1), bsonDAllowed|bsonMAllowed)
+	if doc, ok := parm.(bson.D); err != nil || !ok || ShellJSON(doc) != "{ a: 1 }" {
+		t.Errorf("expected verifyParm to return the filter, got %v %v", parm, err)
+	}
+}
+
+func TestQueryFind(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(5)})
+	defer server.close()
+	defer db.Disconnect()
+
+	zips := db.Coll("zips")
+
+	docs := zips.Find(Q().Eq("state", "NV")).ToArray()
+	if db.Err != nil || len(docs) != 2 {
+		t.Errorf("expected 2 documents, got %d, error %v", len(docs), db.Err)
+	}
+
+	if n := zips.CountDocuments(Q().Eq("state", "CA")); n != 3 {
+		t.Errorf("expected a count of 3, got %d", n)
+	}
+
+	docs = zips.Aggregate(NewPipeline().Match(Q().Eq("state", "CA"))).ToArray()
+	if db.Err != nil || len(docs) != 3 {
+		t.Errorf("expected 3 documents, got %d, error %v", len(docs), db.Err)
+	}
+
+	doc := zips.FindOne(Q().Eq("_id", 2))
+	if db.Err != nil || ShellJSON(*doc) != `{ _id: 2, state: "NV" }` {
+		t.Errorf("expected the document with _id 2, got %s, error %v", ShellJSON(*doc), db.Err)
+	}
+
+	zips.Find(Q().Eq("a", 1).Or(`{"b":`))
+	if db.Err == nil {
+		t.Errorf("expected the Query error")
+	}
+}
@@ -0,0 +1,184 @@
+package mongolang
+
+/*
+	Format BSON values using the MongoDB Shell (mongosh) syntax so
+	they can be copied and pasted into the shell, for example:
+
+		{ state: "CA", _id: ObjectId("5f8f8c44b54764421b7156c5"), date: { $gt: ISODate("2021-01-01T00:00:00Z") } }
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// shellKeyRE matches keys which don't need to be quoted in the shell
+var shellKeyRE = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// ShellJSON returns a BSON value, such as a bson.D, bson.M, bson.A
+// or []bson.D, formatted on a single line using MongoDB Shell syntax.
+func ShellJSON(v interface{}) string {
+	var buf bytes.Buffer
+	writeShellJSON(&buf, v)
+	return buf.String()
+}
+
+// writeShellJSON writes a value using MongoDB Shell syntax
+func writeShellJSON(buf *bytes.Buffer, v interface{}) {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case *bson.D:
+		writeShellJSON(buf, *val)
+	case *Query:
+		writeShellDoc(buf, val.Filter)
+	case bson.D:
+		writeShellDoc(buf, val)
+	case bson.M:
+		doc, _ := toBsonD(val)
+		writeShellDoc(buf, doc)
+	case bson.A:
+		writeShellArray(buf, val)
+	case []bson.D:
+		a := make(bson.A, len(val))
+		for i, doc := range val {
+			a[i] = doc
+		}
+		writeShellArray(buf, a)
+	case []interface{}:
+		writeShellArray(buf, bson.A(val))
+	case string:
+		buf.WriteString(shellString(val))
+	case bool:
+		buf.WriteString(strconv.FormatBool(val))
+	case int:
+		buf.WriteString(strconv.Itoa(val))
+	case int32:
+		buf.WriteString(strconv.FormatInt(int64(val), 10))
+	case int64:
+		// the shell reads numbers as doubles which are exact up to 2^53
+		if val > 1<<53 || val < -(1<<53) {
+			fmt.Fprintf(buf, "NumberLong(\"%d\")", val)
+		} else {
+			buf.WriteString(strconv.FormatInt(val, 10))
+		}
+	case float64:
+		buf.WriteString(shellFloat(val))
+	case primitive.ObjectID:
+		fmt.Fprintf(buf, "ObjectId(%q)", val.Hex())
+	case primitive.DateTime:
+		fmt.Fprintf(buf, "ISODate(%q)", val.Time().UTC().Format(time.RFC3339Nano))
+	case time.Time:
+		fmt.Fprintf(buf, "ISODate(%q)", val.UTC().Format(time.RFC3339Nano))
+	case primitive.Regex:
+		fmt.Fprintf(buf, "/%s/%s", strings.Replace(val.Pattern, "/", `\/`, -1), val.Options)
+	case primitive.Decimal128:
+		fmt.Fprintf(buf, "NumberDecimal(%q)", val.String())
+	case primitive.Timestamp:
+		fmt.Fprintf(buf, "Timestamp({ t: %d, i: %d })", val.T, val.I)
+	case primitive.Binary:
+		if val.Subtype == 4 && len(val.Data) == 16 {
+			d := fmt.Sprintf("%x", val.Data)
+			fmt.Fprintf(buf, "UUID(%q)", d[0:8]+"-"+d[8:12]+"-"+d[12:16]+"-"+d[16:20]+"-"+d[20:])
+		} else {
+			writeShellExtJSON(buf, v)
+		}
+	case primitive.Null:
+		buf.WriteString("null")
+	case primitive.MinKey:
+		buf.WriteString("MinKey()")
+	case primitive.MaxKey:
+		buf.WriteString("MaxKey()")
+	default:
+		writeShellExtJSON(buf, v)
+	}
+}
+
+// writeShellDoc writes a document, quoting keys only when necessary
+func writeShellDoc(buf *bytes.Buffer, doc bson.D) {
+	if len(doc) == 0 {
+		buf.WriteString("{}")
+		return
+	}
+
+	buf.WriteString("{ ")
+	for i, e := range doc {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+
+		if shellKeyRE.MatchString(e.Key) {
+			buf.WriteString(e.Key)
+		} else {
+			buf.WriteString(shellString(e.Key))
+		}
+
+		buf.WriteString(": ")
+		writeShellJSON(buf, e.Value)
+	}
+	buf.WriteString(" }")
+}
+
+// writeShellArray writes an array on a single line
+func writeShellArray(buf *bytes.Buffer, a bson.A) {
+	if len(a) == 0 {
+		buf.WriteString("[]")
+		return
+	}
+
+	buf.WriteString("[ ")
+	for i, v := range a {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		writeShellJSON(buf, v)
+	}
+	buf.WriteString(" ]")
+}
+
+// writeShellExtJSON writes a value with no shell syntax of its own as
+// relaxed Extended JSON, which the shell also accepts
+func writeShellExtJSON(buf *bytes.Buffer, v interface{}) {
+	json, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, false, false)
+	if err != nil {
+		fmt.Fprintf(buf, "%q", fmt.Sprintf("%v", v))
+		return
+	}
+
+	// strip the {"v": ... } wrapper
+	buf.Write(json[5 : len(json)-1])
+}
+
+// shellString returns a string as a double quoted JavaScript string
+func shellString(s string) string {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// shellFloat returns a float64 so that the shell reads it back as the same value
+func shellFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,45 @@
+package mongolang
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShellJSON(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("5f8f8c44b54764421b7156c5")
+	date := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	decimal, _ := primitive.ParseDecimal128("1.50")
+	uuid := primitive.Binary{Subtype: 4, Data: []byte{0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x56, 0x78}}
+
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{bson.D{}, "{}"},
+		{bson.A{}, "[]"},
+		{bson.D{{Key: "state", Value: "CA"}, {Key: "a.b", Value: int32(1)}}, `{ state: "CA", "a.b": 1 }`},
+		{bson.M{"b": true, "a": nil}, "{ a: null, b: true }"},
+		{bson.A{1.5, int64(7), int64(1) << 60}, `[ 1.5, 7, NumberLong("1152921504606846976") ]`},
+		{[]bson.D{{{Key: "$limit", Value: 1}}}, "[ { $limit: 1 } ]"},
+		{id, `ObjectId("5f8f8c44b54764421b7156c5")`},
+		{primitive.NewDateTimeFromTime(date), `ISODate("2021-01-02T03:04:05Z")`},
+		{date, `ISODate("2021-01-02T03:04:05Z")`},
+		{primitive.Regex{Pattern: "^a/b", Options: "i"}, `/^a\/b/i`},
+		{decimal, `NumberDecimal("1.50")`},
+		{uuid, `UUID("12345678-1234-5678-1234-567812345678")`},
+		{primitive.Timestamp{T: 1, I: 2}, "Timestamp({ t: 1, i: 2 })"},
+		{math.Inf(-1), "-Infinity"},
+		{"<a & \"b\">", `"<a & \"b\">"`},
+		{primitive.Binary{Subtype: 0, Data: []byte{1}}, `{"$binary":{"base64":"AQ==","subType":"00"}}`},
+	}
+
+	for _, test := range tests {
+		if got := ShellJSON(test.value); got != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,731 @@
+package mongolang
+
+/*
+	A parser for the MongoDB Shell (mongosh) syntax, so that filters,
+	documents and pipelines can be pasted from the shell:
+
+		db.Coll("people").Find(`{state: 'CA', dob: {$gt: ISODate("2001-01-01")}, name: /^John/i}`)
+
+	verifyParm tries strict Extended JSON first and only uses this parser if that fails.
+	In addition to JSON it accepts:
+
+		unquoted keys       {state: "CA"}
+		single quotes       {state: 'CA'}
+		trailing commas     [1, 2, 3,]
+		comments            // to the end of the line, and block comments
+		regular expressions /^John/i
+		ObjectId("5f8f8c44b54764421b7156c5")
+		ISODate("2021-01-01"), ISODate("2021-01-01T10:30:00Z"), new Date("2021-01-01")
+		NumberInt(5), NumberLong(5), NumberLong("5"), NumberDecimal("1.50")
+		UUID("12345678-1234-5678-1234-567812345678"), BinData(0, "AQ==")
+		Timestamp(1, 2), Timestamp({t: 1, i: 2}), MinKey(), MaxKey()
+		Infinity, NaN, undefined
+
+	Extended JSON such as {"$oid": "..."} may be mixed in. As for Extended JSON,
+	integers are parsed as int32 unless too large, when they are parsed as int64.
+*/
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// layouts accepted by ISODate(), as in the MongoDB Shell
+var isoDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// the functions shellConstructor supports, for error messages
+const shellFunctions = "ObjectId, ISODate, Date, NumberInt, NumberLong, NumberDecimal, UUID, BinData, Timestamp, MinKey or MaxKey"
+
+// Extended JSON keys for values, such as {"$oid": "..."}
+var extJSONKeys = []string{
+	"$binary", "$code", "$date", "$maxKey", "$minKey", "$numberDecimal", "$numberDouble",
+	"$numberInt", "$numberLong", "$oid", "$regularExpression", "$symbol", "$timestamp", "$uuid",
+}
+
+// shellParser holds the state while parsing a string
+type shellParser struct {
+	s   string
+	pos int
+}
+
+// parseShellJSON parses a document, array or value in MongoDB Shell syntax
+func parseShellJSON(s string) (interface{}, error) {
+	p := &shellParser{s: s}
+
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.peek() == ';' {
+		p.pos++
+		p.skipSpace()
+	}
+
+	if p.pos < len(p.s) {
+		return nil, p.hintf("remove the extra text, or put a list of documents in [ ]",
+			"unexpected %s after the end of the value", p.next())
+	}
+
+	return v, nil
+}
+
+// value parses any value
+func (p *shellParser) value() (interface{}, error) {
+	p.skipSpace()
+
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, p.hintf("check for a missing value, } or ]", "unexpected end of input")
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"' || c == '\'':
+		return p.quoted()
+	case c == '/':
+		return p.regex()
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	case isIdentStart(c):
+		return p.identValue()
+	}
+
+	return nil, p.errorf("unexpected %s", p.next())
+}
+
+// object parses a document
+func (p *shellParser) object() (interface{}, error) {
+	p.pos++ // {
+	doc := bson.D{}
+
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			v, err := extJSONValue(doc)
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			return v, nil
+		}
+
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if p.peek() != ':' {
+			return nil, p.hintf("add a : between the key and its value",
+				"expected : after key %q, found %s", key, p.next())
+		}
+		p.pos++
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: key, Value: v})
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			return nil, p.hintf(p.missing("}"), "expected , or } after the value for %q, found %s", key, p.next())
+		}
+	}
+}
+
+// array parses an array
+func (p *shellParser) array() (interface{}, error) {
+	p.pos++ // [
+	a := bson.A{}
+
+	for {
+		p.skipSpace()
+		if p.peek() == ']' {
+			p.pos++
+			return a, nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.hintf(p.missing("]"), "expected , or ] after an array element, found %s", p.next())
+		}
+	}
+}
+
+// key parses a quoted or unquoted key
+func (p *shellParser) key() (string, error) {
+	c := p.peek()
+	if c == '"' || c == '\'' {
+		return p.quoted()
+	}
+
+	if !isIdentStart(c) {
+		return "", p.hintf("a key must be a name or a quoted string", "expected a key, found %s", p.next())
+	}
+
+	return p.ident(), nil
+}
+
+// quoted parses a single or double quoted string
+func (p *shellParser) quoted() (string, error) {
+	quote := p.s[p.pos]
+	start := p.pos
+	p.pos++
+
+	var buf strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return buf.String(), nil
+		case c == '\n':
+			p.pos = start
+			return "", p.hintf("add the closing quote", "unterminated string")
+		case c == '\\':
+			if err := p.escape(&buf); err != nil {
+				return "", err
+			}
+		default:
+			buf.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	p.pos = start
+	return "", p.hintf("add the closing quote", "unterminated string")
+}
+
+// escape parses an escape sequence in a string
+func (p *shellParser) escape(buf *strings.Builder) error {
+	p.pos++ // backslash
+	if p.pos >= len(p.s) {
+		return p.errorf("unterminated string")
+	}
+
+	c := p.s[p.pos]
+	p.pos++
+
+	switch c {
+	case 'n':
+		buf.WriteByte('\n')
+	case 't':
+		buf.WriteByte('\t')
+	case 'r':
+		buf.WriteByte('\r')
+	case 'b':
+		buf.WriteByte('\b')
+	case 'f':
+		buf.WriteByte('\f')
+	case 'v':
+		buf.WriteByte('\v')
+	case '0':
+		buf.WriteByte(0)
+	case 'x', 'u':
+		size := 2
+		if c == 'u' {
+			size = 4
+		}
+		if p.pos+size > len(p.s) {
+			return p.errorf("invalid escape \\%c", c)
+		}
+		n, err := strconv.ParseUint(p.s[p.pos:p.pos+size], 16, 32)
+		if err != nil {
+			return p.errorf("invalid escape \\%c%s", c, p.s[p.pos:p.pos+size])
+		}
+		p.pos += size
+		buf.WriteRune(rune(n))
+	default:
+		buf.WriteByte(c)
+	}
+
+	return nil
+}
+
+// regex parses a regular expression literal such as /^a\/b/i
+func (p *shellParser) regex() (interface{}, error) {
+	start := p.pos
+	p.pos++ // /
+
+	var pattern strings.Builder
+	inClass := false
+	for {
+		if p.pos >= len(p.s) || p.s[p.pos] == '\n' {
+			p.pos = start
+			return nil, p.hintf("add the closing /", "unterminated regular expression")
+		}
+
+		c := p.s[p.pos]
+		p.pos++
+
+		switch {
+		case c == '\\' && p.pos < len(p.s):
+			// \/ is only needed to end the literal
+			if p.s[p.pos] != '/' {
+				pattern.WriteByte(c)
+			}
+			pattern.WriteByte(p.s[p.pos])
+			p.pos++
+			continue
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			options := p.ident()
+			for _, o := range options {
+				if !strings.ContainsRune("imsxlu", o) {
+					return nil, p.errorf("invalid regular expression flag %q", o)
+				}
+			}
+			return primitive.Regex{Pattern: pattern.String(), Options: options}, nil
+		}
+
+		pattern.WriteByte(c)
+	}
+}
+
+// number parses a number. Integers are int32 unless too large.
+func (p *shellParser) number() (interface{}, error) {
+	start := p.pos
+
+	if c := p.peek(); c == '-' || c == '+' {
+		p.pos++
+		if isIdentStart(p.peek()) {
+			name := p.ident()
+			if name == "Infinity" {
+				if c == '-' {
+					return math.Inf(-1), nil
+				}
+				return math.Inf(1), nil
+			}
+			p.pos = start
+			return nil, p.errorf("invalid number %s", p.s[start:start+1]+name)
+		}
+	}
+
+	isFloat := false
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' || c == 'e' || c == 'E':
+			isFloat = true
+		case (c == '-' || c == '+') && (p.s[p.pos-1] == 'e' || p.s[p.pos-1] == 'E'):
+		default:
+			return p.parseNumber(start, p.s[start:p.pos], isFloat)
+		}
+		p.pos++
+	}
+
+	return p.parseNumber(start, p.s[start:p.pos], isFloat)
+}
+
+// parseNumber converts the text of a number
+func (p *shellParser) parseNumber(start int, text string, isFloat bool) (interface{}, error) {
+	if !isFloat {
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			if n >= math.MinInt32 && n <= math.MaxInt32 {
+				return int32(n), nil
+			}
+			return n, nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %s", text)
+	}
+
+	return f, nil
+}
+
+// identValue parses a value which starts with an identifier, such as
+// true, null or a constructor such as ObjectId("...")
+func (p *shellParser) identValue() (interface{}, error) {
+	start := p.pos
+	name := p.ident()
+
+	switch name {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "undefined":
+		return primitive.Undefined{}, nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "NaN":
+		return math.NaN(), nil
+	case "new":
+		p.skipSpace()
+		if !isIdentStart(p.peek()) {
+			return nil, p.errorf("expected a constructor after new")
+		}
+		start = p.pos
+		name = p.ident()
+	}
+
+	p.skipSpace()
+	if p.peek() != '(' {
+		p.pos = start
+		return nil, p.hintf(fmt.Sprintf("use quotes, such as %q", name), "unexpected %s, strings must be quoted", name)
+	}
+	p.pos++
+
+	args, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := shellConstructor(name, args)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("%v", err)
+	}
+
+	return v, nil
+}
+
+// args parses the arguments to a constructor, up to and including the )
+func (p *shellParser) args() ([]interface{}, error) {
+	args := []interface{}{}
+
+	for {
+		p.skipSpace()
+		if p.peek() == ')' {
+			p.pos++
+			return args, nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+		default:
+			return nil, p.hintf(p.missing(")"), "expected , or ) after an argument, found %s", p.next())
+		}
+	}
+}
+
+// shellConstructor creates the value for a constructor such as ObjectId("...")
+func shellConstructor(name string, args []interface{}) (interface{}, error) {
+	str := func() (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("%s() requires one argument", name)
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return "", fmt.Errorf("%s() requires a string", name)
+		}
+		return s, nil
+	}
+
+	switch name {
+	case "ObjectId":
+		if len(args) == 0 {
+			return primitive.NewObjectID(), nil
+		}
+		s, err := str()
+		if err != nil {
+			return nil, err
+		}
+		return primitive.ObjectIDFromHex(s)
+
+	case "ISODate", "Date":
+		if len(args) == 0 {
+			return primitive.NewDateTimeFromTime(time.Now()), nil
+		}
+		if ms, ok := args[0].(int32); ok && len(args) == 1 {
+			return primitive.DateTime(ms), nil
+		}
+		if ms, ok := args[0].(int64); ok && len(args) == 1 {
+			return primitive.DateTime(ms), nil
+		}
+		s, err := str()
+		if err != nil {
+			return nil, err
+		}
+		for _, layout := range isoDateLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return primitive.NewDateTimeFromTime(t), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date %q, use a date such as \"2021-01-31\" or \"2021-01-31T10:30:00Z\"", s)
+
+	case "NumberInt", "NumberLong", "Int32", "Long":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s() requires one argument", name)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(fmt.Sprint(args[0])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s(%v)", name, args[0])
+		}
+		if name == "NumberInt" || name == "Int32" {
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("%s(%d) is out of range", name, n)
+			}
+			return int32(n), nil
+		}
+		return n, nil
+
+	case "NumberDecimal", "Decimal128":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s() requires one argument", name)
+		}
+		return primitive.ParseDecimal128(fmt.Sprint(args[0]))
+
+	case "UUID":
+		s, err := str()
+		if err != nil {
+			return nil, err
+		}
+		data, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+		if err != nil || len(data) != 16 {
+			return nil, fmt.Errorf("invalid UUID %q", s)
+		}
+		return primitive.Binary{Subtype: 4, Data: data}, nil
+
+	case "BinData":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("BinData() requires a subtype and a base64 string")
+		}
+		subtype, ok1 := args[0].(int32)
+		s, ok2 := args[1].(string)
+		data, err := base64.StdEncoding.DecodeString(s)
+		if !ok1 || !ok2 || err != nil || subtype < 0 || subtype > 255 {
+			return nil, fmt.Errorf("BinData() requires a subtype and a base64 string")
+		}
+		return primitive.Binary{Subtype: byte(subtype), Data: data}, nil
+
+	case "Timestamp":
+		var t, i interface{}
+		if len(args) == 1 {
+			doc, _ := args[0].(bson.D)
+			t, i = lookup(doc, "t"), lookup(doc, "i")
+		} else if len(args) == 2 {
+			t, i = args[0], args[1]
+		}
+		tn, err1 := optInt64(bson.E{Value: t})
+		in, err2 := optInt64(bson.E{Value: i})
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("Timestamp() requires t and i, such as Timestamp(1, 2)")
+		}
+		return primitive.Timestamp{T: uint32(tn), I: uint32(in)}, nil
+
+	case "MinKey":
+		return primitive.MinKey{}, nil
+
+	case "MaxKey":
+		return primitive.MaxKey{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown function %s(), use one of %s", name, shellFunctions)
+}
+
+// extJSONValue returns a document such as {"$oid": "..."} as the value it represents
+func extJSONValue(doc bson.D) (interface{}, error) {
+	if len(doc) == 0 || !containsString(extJSONKeys, doc[0].Key) {
+		return doc, nil
+	}
+
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: doc}}, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result bson.D
+	if err := bson.UnmarshalExtJSON(data, true, &result); err != nil {
+		return nil, err
+	}
+
+	return result[0].Value, nil
+}
+
+// skipSpace skips white space and comments
+func (p *shellParser) skipSpace() {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case strings.HasPrefix(p.s[p.pos:], "//"):
+			if end := strings.IndexByte(p.s[p.pos:], '\n'); end >= 0 {
+				p.pos += end
+			} else {
+				p.pos = len(p.s)
+			}
+		case strings.HasPrefix(p.s[p.pos:], "/*"):
+			if end := strings.Index(p.s[p.pos+2:], "*/"); end >= 0 {
+				p.pos += end + 4
+			} else {
+				p.pos = len(p.s)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// ident parses an identifier, which may be empty
+func (p *shellParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) && (isIdentStart(p.s[p.pos]) || (p.s[p.pos] >= '0' && p.s[p.pos] <= '9')) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// peek returns the next byte, or 0 at the end of input
+func (p *shellParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+// next describes the next character for an error message
+func (p *shellParser) next() string {
+	if p.pos >= len(p.s) {
+		return "end of input"
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[p.pos:])
+	return strconv.QuoteRune(r)
+}
+
+// errorf returns a ParseError at the current position
+func (p *shellParser) errorf(format string, a ...interface{}) error {
+	return p.hintf("", format, a...)
+}
+
+// hintf returns a ParseError at the current position with a hint on how to fix it
+func (p *shellParser) hintf(hint string, format string, a ...interface{}) error {
+	lineStart := strings.LastIndexByte(p.s[:p.pos], '\n') + 1
+	lineEnd := strings.IndexByte(p.s[p.pos:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(p.s)
+	} else {
+		lineEnd += p.pos
+	}
+
+	return &ParseError{
+		Line:    1 + strings.Count(p.s[:p.pos], "\n"),
+		Column:  1 + utf8.RuneCountInString(p.s[lineStart:p.pos]),
+		Offset:  p.pos,
+		Snippet: snippet(p.s[lineStart:lineEnd], p.pos-lineStart),
+		Msg:     fmt.Sprintf(format, a...),
+		Hint:    hint,
+	}
+}
+
+// missing returns the hint when a separator or closing bracket was expected
+func (p *shellParser) missing(closing string) string {
+	if p.pos >= len(p.s) {
+		return "add the missing " + closing
+	}
+	return "add a comma between values, or the missing " + closing
+}
+
+// isIdentStart returns true if c can start a JavaScript identifier
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// ParseError is the error for a JSON or MongoDB Shell syntax string which can't be parsed.
+// Line and Column are where the error was found, starting from 1, and Offset is the byte offset.
+// Snippet is the line with the error followed by a line with a ^ under the column.
+type ParseError struct {
+	Line    int
+	Column  int
+	Offset  int
+	Snippet string
+	Msg     string
+	Hint    string
+}
+
+// Error returns the message, snippet and hint, for example:
+//
+//	line 3, column 3: expected , or } after the value for "state", found 'c'
+//	  city: 'DAVIS'
+//	  ^
+//	hint: add a comma between values, or the missing }
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("line %d, column %d: %s\n%s", e.Line, e.Column, e.Msg, e.Snippet)
+	if e.Hint != "" {
+		msg += "\nhint: " + e.Hint
+	}
+	return msg
+}
+
+// snippetWidth is the most characters of a line shown in a ParseError snippet
+const snippetWidth = 72
+
+// snippet returns a line with a ^ below the byte offset col,
+// shortening long lines to show the text around col
+func snippet(line string, col int) string {
+	before, after := line[:col], line[col:]
+
+	if n := utf8.RuneCountInString(before); n > snippetWidth/2 {
+		r := []rune(before)
+		before = "..." + string(r[n-snippetWidth/2:])
+	}
+	if r := []rune(after); len(r) > snippetWidth/2 {
+		after = string(r[:snippetWidth/2]) + "..."
+	}
+
+	// keep tabs so that the caret lines up
+	var caret strings.Builder
+	for _, r := range before {
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+
+	return before + after + "\n" + caret.String()
+}
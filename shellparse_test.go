@@ -0,0 +1,193 @@
+package mongolang
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseShellJSON(t *testing.T) {
+	tests := []struct {
+		shell    string
+		expected string
+	}{
+		{`{state: 'CA', "pop": 5,}`, `{ state: "CA", pop: 5 }`},
+		{`[1, 2.5, -3, 1e3, 3000000000, .5, +4,]`, `[ 1, 2.5, -3, 1000, 3000000000, 0.5, 4 ]`},
+		{`{_id: ObjectId("5f8f8c44b54764421b7156c5")}`, `{ _id: ObjectId("5f8f8c44b54764421b7156c5") }`},
+		{`{date: {$gt: ISODate("2021-01-01"), $lt: new Date("2021-01-02T10:30:00.5Z")}}`,
+			`{ date: { $gt: ISODate("2021-01-01T00:00:00Z"), $lt: ISODate("2021-01-02T10:30:00.5Z") } }`},
+		{`{d: ISODate("2021-01-01T10:30:00+01:00")}`, `{ d: ISODate("2021-01-01T09:30:00Z") }`},
+		{`{name: /^John\/Jr/i}`, `{ name: /^John\/Jr/i }`},
+		{`{name: /[/]x/}`, `{ name: /[\/]x/ }`},
+		{`{a: NumberLong(5), b: NumberLong("9007199254740993"), c: NumberInt("7"), d: NumberDecimal("1.50")}`,
+			`{ a: 5, b: NumberLong("9007199254740993"), c: 7, d: NumberDecimal("1.50") }`},
+		{`{u: UUID("12345678-1234-5678-1234-567812345678"), b: BinData(0, "AQ==")}`,
+			`{ u: UUID("12345678-1234-5678-1234-567812345678"), b: {"$binary":{"base64":"AQ==","subType":"00"}} }`},
+		{`{t: Timestamp(1, 2), t2: Timestamp({t: 3, i: 4}), min: MinKey(), max: MaxKey()}`,
+			`{ t: Timestamp({ t: 1, i: 2 }), t2: Timestamp({ t: 3, i: 4 }), min: MinKey(), max: MaxKey() }`},
+		{`{a: true, b: false, c: null, d: -Infinity}`, `{ a: true, b: false, c: null, d: -Infinity }`},
+		{`{s: 'it\'s "quoted"\né\x41'}`, `{ s: "it's \"quoted\"\néA" }`},
+		{`{
+			// a line comment
+			state: "CA", /* a block
+			comment */ city: "DAVIS"
+		};`, `{ state: "CA", city: "DAVIS" }`},
+		{`{_id: {"$oid": "5f8f8c44b54764421b7156c5"}, n: {$numberLong: "5"}}`,
+			`{ _id: ObjectId("5f8f8c44b54764421b7156c5"), n: 5 }`},
+		{`[{$match: {state: 'CA'}}, {$group: {_id: "$city", n: {$sum: 1}}},]`,
+			`[ { $match: { state: "CA" } }, { $group: { _id: "$city", n: { $sum: 1 } } } ]`},
+	}
+
+	for _, test := range tests {
+		v, err := parseShellJSON(test.shell)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", test.shell, err)
+			continue
+		}
+
+		if got := ShellJSON(v); got != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, got)
+		}
+	}
+
+	v, _ := parseShellJSON(`[1, 3000000000, NumberLong(1), NumberInt(1), 1.0, NaN]`)
+	a := v.(bson.A)
+	if _, ok := a[0].(int32); !ok {
+		t.Errorf("expected int32, got %T", a[0])
+	}
+	if _, ok := a[1].(int64); !ok {
+		t.Errorf("expected int64, got %T", a[1])
+	}
+	if _, ok := a[2].(int64); !ok {
+		t.Errorf("expected int64 for NumberLong, got %T", a[2])
+	}
+	if _, ok := a[3].(int32); !ok {
+		t.Errorf("expected int32 for NumberInt, got %T", a[3])
+	}
+	if _, ok := a[4].(float64); !ok {
+		t.Errorf("expected float64, got %T", a[4])
+	}
+	if f, ok := a[5].(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("expected NaN, got %v", a[5])
+	}
+
+	v, _ = parseShellJSON(`{re: /a/g}`)
+	if v != nil {
+		t.Errorf("expected an invalid regular expression flag to fail")
+	}
+}
+
+func TestParseShellJSONErrors(t *testing.T) {
+	tests := []struct {
+		shell  string
+		msg    string
+		line   int
+		column int
+	}{
+		{`{state: CA}`, "unexpected CA, strings must be quoted", 1, 9},
+		{"{\n  state: 'CA'\n  city: 'DAVIS'\n}", `expected , or } after the value for "state", found 'c'`, 3, 3},
+		{`{a: ObjectId("xyz")}`, "the provided hex string is not a valid ObjectID", 1, 5},
+		{`{a: ISODate("Jan 1")}`, `invalid date "Jan 1", use a date such as "2021-01-31" or "2021-01-31T10:30:00Z"`, 1, 5},
+		{`{a: Foo(1)}`, "unknown function Foo(), use one of " + shellFunctions, 1, 5},
+		{`{a: 'abc}`, "unterminated string", 1, 5},
+		{`{a: /abc}`, "unterminated regular expression", 1, 5},
+		{`{a: 1`, `expected , or } after the value for "a", found end of input`, 1, 6},
+		{`{a: 1} x`, "unexpected 'x' after the end of the value", 1, 8},
+		{``, "unexpected end of input", 1, 1},
+		{"[\n\t{é: 1}]", "expected a key, found 'é'", 2, 3},
+	}
+
+	for _, test := range tests {
+		_, err := parseShellJSON(test.shell)
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("expected a ParseError for %s, got %v", test.shell, err)
+			continue
+		}
+
+		if parseErr.Msg != test.msg || parseErr.Line != test.line || parseErr.Column != test.column {
+			t.Errorf("expected %q at %d:%d for %s, got %q at %d:%d", test.msg, test.line, test.column,
+				test.shell, parseErr.Msg, parseErr.Line, parseErr.Column)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := verifyParm("{\n  state: 'CA'\n  city: 'DAVIS'\n}", bsonDAllowed)
+
+	expected := `line 3, column 3: expected , or } after the value for "state", found 'c'
+  city: 'DAVIS'
+  ^
+hint: add a comma between values, or the missing }`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%v", expected, err)
+	}
+
+	_, err = verifyParm("[\t{state: CA}]", bsonDSliceAllowed)
+	if parseErr, ok := err.(*ParseError); !ok || parseErr.Snippet != "[\t{state: CA}]\n \t        ^" ||
+		parseErr.Hint != `use quotes, such as "CA"` || parseErr.Offset != 10 {
+		t.Errorf("expected the caret under CA, got %#v", err)
+	}
+
+	// long lines are shortened around the error
+	long := `{"a": "` + strings.Repeat("x", 100) + `", b c}`
+	_, err = verifyParm(long, bsonDAllowed)
+	if parseErr, ok := err.(*ParseError); !ok ||
+		parseErr.Snippet != "..."+strings.Repeat("x", 31)+`", b c}`+"\n"+strings.Repeat(" ", 39)+"^" {
+		t.Errorf("expected a shortened snippet, got %#v", err)
+	}
+
+	// errors are only logged when a Logger is set
+	var buf bytes.Buffer
+	Logger = log.New(&buf, "", 0)
+	defer func() { Logger = nil }()
+
+	verifyParm(`{a: }`, bsonDAllowed)
+	if !strings.HasPrefix(buf.String(), "error parsing JSON: line 1, column 5: unexpected '}'") {
+		t.Errorf("expected the error to be logged, got %q", buf.String())
+	}
+}
+
+func TestParseErrorWrapped(t *testing.T) {
+	errs := []error{
+		NewPipeline().Match(`{state: CA}`).Err,
+		Q().Or(`{state: CA}`).Err,
+	}
+
+	for _, err := range errs {
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != 1 || parseErr.Column != 9 {
+			t.Errorf("expected a wrapped ParseError, got %#v", err)
+		}
+	}
+}
+
+func TestVerifyParmShellSyntax(t *testing.T) {
+	parm, err := verifyParm(`{name: /^John/i, n: NumberLong(5)}`, bsonDAllowed)
+	doc, ok := parm.(bson.D)
+	if err != nil || !ok || len(doc) != 2 {
+		t.Fatalf("expected a bson.D, got %v %v", parm, err)
+	}
+
+	if re, ok := doc[0].Value.(primitive.Regex); !ok || re.Pattern != "^John" || re.Options != "i" {
+		t.Errorf("expected a regex, got %v", doc[0].Value)
+	}
+
+	// strict Extended JSON is unchanged, including relaxed numbers
+	parm, err = verifyParm(`{"n":{"$numberLong":"5"},"a":1}`, bsonDAllowed)
+	doc, _ = parm.(bson.D)
+	if _, ok := doc[0].Value.(int64); err != nil || !ok {
+		t.Errorf("expected int64, got %T %v", doc[0].Value, err)
+	}
+
+	parm, err = verifyParm(`[{$match: {state: 'CA'}}]`, bsonDSliceAllowed)
+	if stages, ok := parm.([]bson.D); err != nil || !ok || len(stages) != 1 {
+		t.Errorf("expected a pipeline, got %v %v", parm, err)
+	}
+}
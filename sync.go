@@ -0,0 +1,350 @@
+package mongolang
+
+/*
+	Keep a copy of a Collection, possibly in another Database or on
+	another server, up to date via a change stream.
+
+		reporting := DB{}
+		reporting.InitMonGolang("mongodb://reporting:27017").Use("reports")
+
+		s := db.Coll("orders").SyncTo(reporting.Coll("orders"), "orders.checkpoint")
+		done := make(chan error)
+		go func() { done <- s.Run() }()
+		...
+		s.Stop()
+		err := <-done
+		fmt.Println(s.Verify())
+
+	The first Run() copies every document from the source to the target, then
+	applies the changes from the source change stream. The resume token for the
+	last change applied is saved in the checkpoint file so a later Run()
+	skips the copy and continues from where the previous one stopped.
+	Delete the checkpoint file to force a new copy.
+
+	Documents are copied and updated by replacing the whole target document,
+	so applying a change more than once has no further effect.
+	Changes to the target which aren't made by Sync are not reverted
+	unless the same document changes in the source.
+*/
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// syncBatchSize is the number of documents written per bulk write during the initial copy
+const syncBatchSize = 1000
+
+// Sync copies a source Collection to a target Collection and then applies
+// the changes made to the source. Copied is the number of documents copied
+// and Applied the number of changes applied by Run().
+type Sync struct {
+	Source         *Coll
+	Target         *Coll
+	CheckpointPath string
+
+	Copied  int64
+	Applied int64
+
+	stopped int32
+}
+
+// SyncVerification compares the source and target of a Sync.
+// The hashes are of every document, in _id order.
+// Match is true if both the counts and hashes are the same.
+// Err is the error, if any, reading either collection.
+type SyncVerification struct {
+	SourceCount int64
+	TargetCount int64
+	SourceHash  string
+	TargetHash  string
+	Match       bool
+	Err         error
+}
+
+// SyncTo returns a Sync which copies the collection to target,
+// saving the checkpoint in the file checkpointPath.
+func (c *Coll) SyncTo(target *Coll, checkpointPath string) *Sync {
+	return &Sync{Source: c, Target: target, CheckpointPath: checkpointPath}
+}
+
+// Run copies the source collection to the target, unless there is a checkpoint,
+// then applies changes until Stop() is called or there is an error, which is returned.
+// DB.Err is not changed for either DB, so they can be used by other goroutines while Run() runs.
+func (s *Sync) Run() error {
+	if !s.collsOkay() {
+		return ErrInvalidColl
+	}
+
+	atomic.StoreInt32(&s.stopped, 0)
+
+	return s.run()
+}
+
+// run does the work of Run()
+func (s *Sync) run() error {
+	checkpoint, err := readTokenFile(s.CheckpointPath)
+	if err != nil {
+		return err
+	}
+
+	opts := bson.D{{Key: "fullDocument", Value: "updateLookup"}, {Key: "maxAwaitTimeMS", Value: 1000}}
+	if checkpoint != nil {
+		opts = append(opts, bson.E{Key: "resumeAfter", Value: checkpoint})
+	}
+
+	// open the change stream before copying so that no changes are missed
+	source := &Coll{DB: s.Source.DB.sharedConnection(), MongoColl: s.Source.MongoColl, CollName: s.Source.CollName}
+	cs := source.Watch(nil, opts)
+	if err = cs.Err(); err != nil {
+		return err
+	}
+	defer cs.Close()
+
+	if checkpoint == nil {
+		if err = s.copyAll(); err != nil {
+			return err
+		}
+
+		// without a checkpoint the next Run() starts the copy again
+		if s.isStopped() {
+			return nil
+		}
+
+		if err = s.saveCheckpoint(cs.ResumeToken()); err != nil {
+			return err
+		}
+	}
+
+	for !s.isStopped() {
+		if !cs.TryNext() {
+			if err = cs.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = s.apply(*cs.Next()); err != nil {
+			return err
+		}
+
+		if err = s.saveCheckpoint(cs.ResumeToken()); err != nil {
+			return err
+		}
+
+		s.Applied++
+	}
+
+	return nil
+}
+
+// Stop stops Run(), including during the initial copy.
+// It is safe to call Stop() from another goroutine.
+func (s *Sync) Stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+}
+
+// isStopped returns true if Stop() has been called
+func (s *Sync) isStopped() bool {
+	return atomic.LoadInt32(&s.stopped) != 0
+}
+
+// collsOkay returns true if the source and target are linked to a collection
+func (s *Sync) collsOkay() bool {
+	return s.Source != nil && s.Source.DB != nil && s.Source.MongoColl != nil &&
+		s.Target != nil && s.Target.MongoColl != nil
+}
+
+// Reset deletes the checkpoint file so that the next Run() copies every document again
+func (s *Sync) Reset() error {
+	err := os.Remove(s.CheckpointPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// copyAll copies every document in the source to the target,
+// returning early if Stop() is called
+func (s *Sync) copyAll() error {
+	cursor, err := s.Source.MongoColl.Find(context.Background(), bson.D{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	models := []mongo.WriteModel{}
+	for cursor.Next(context.Background()) {
+		if s.isStopped() {
+			return nil
+		}
+
+		doc := bson.D{}
+		if err = cursor.Decode(&doc); err != nil {
+			return err
+		}
+
+		models = append(models, replaceModel(doc))
+		if len(models) == syncBatchSize {
+			if err = s.writeBatch(models); err != nil {
+				return err
+			}
+			models = models[:0]
+		}
+	}
+
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+
+	return s.writeBatch(models)
+}
+
+// writeBatch writes a batch of copied documents to the target
+func (s *Sync) writeBatch(models []mongo.WriteModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+
+	_, err := s.Target.MongoColl.BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(false))
+	if err == nil {
+		s.Copied += int64(len(models))
+	}
+
+	return err
+}
+
+// apply applies a single change event to the target
+func (s *Sync) apply(change bson.D) error {
+	opType, _ := lookup(change, "operationType").(string)
+	documentKey, _ := lookup(change, "documentKey").(bson.D)
+
+	switch opType {
+	case "insert", "update", "replace":
+		doc, ok := lookup(change, "fullDocument").(bson.D)
+		if !ok {
+			// the document was deleted before the update was looked up,
+			// the delete is a following change
+			return nil
+		}
+
+		_, err := s.Target.MongoColl.ReplaceOne(context.Background(), documentKey, doc,
+			options.Replace().SetUpsert(true))
+		return err
+
+	case "delete":
+		_, err := s.Target.MongoColl.DeleteOne(context.Background(), documentKey)
+		return err
+
+	case "drop", "rename", "dropDatabase", "invalidate":
+		return fmt.Errorf("sync stopped by %s of source collection %s", opType, s.Source.CollName)
+	}
+
+	return nil
+}
+
+// saveCheckpoint saves the resume token in the checkpoint file
+func (s *Sync) saveCheckpoint(token bson.D) error {
+	if token == nil {
+		return nil
+	}
+
+	return writeTokenFile(s.CheckpointPath, token)
+}
+
+// Verify compares the number of documents and a hash of
+// every document in the source and target collections.
+// Verify is only meaningful while the source is not changing.
+// Any error is returned in the SyncVerification rather than via DB.Err.
+func (s *Sync) Verify() SyncVerification {
+	result := SyncVerification{}
+
+	if !s.collsOkay() {
+		result.Err = ErrInvalidColl
+		return result
+	}
+
+	result.SourceCount, result.SourceHash, result.Err = collHash(s.Source)
+	if result.Err == nil {
+		result.TargetCount, result.TargetHash, result.Err = collHash(s.Target)
+	}
+
+	if result.Err != nil {
+		return result
+	}
+
+	result.Match = result.SourceCount == result.TargetCount && result.SourceHash == result.TargetHash
+	return result
+}
+
+// collHash returns the number of documents in a collection and
+// a SHA-256 hash of the canonical Extended JSON of each document, in _id order.
+func collHash(c *Coll) (int64, string, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := c.MongoColl.Find(context.Background(), bson.D{}, opts)
+	if err != nil {
+		return 0, "", err
+	}
+	defer cursor.Close(context.Background())
+
+	var count int64
+	h := sha256.New()
+	for cursor.Next(context.Background()) {
+		doc := bson.D{}
+		if err = cursor.Decode(&doc); err != nil {
+			return 0, "", err
+		}
+
+		if err = hashDoc(h, doc); err != nil {
+			return 0, "", err
+		}
+		count++
+	}
+
+	return count, hex.EncodeToString(h.Sum(nil)), cursor.Err()
+}
+
+// hashDoc adds a document to a hash
+func hashDoc(h hash.Hash, doc bson.D) error {
+	json, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return err
+	}
+
+	h.Write(json)
+	h.Write([]byte{'\n'})
+	return nil
+}
+
+// replaceModel returns an upsert which replaces the target document with doc
+func replaceModel(doc bson.D) mongo.WriteModel {
+	return mongo.NewReplaceOneModel().
+		SetFilter(bson.D{{Key: "_id", Value: lookup(doc, "_id")}}).
+		SetReplacement(doc).
+		SetUpsert(true)
+}
+
+// String returns the SyncVerification as a single line
+func (v SyncVerification) String() string {
+	if v.Err != nil {
+		return fmt.Sprintf("ERROR %v", v.Err)
+	}
+
+	status := "MATCH"
+	if !v.Match {
+		status = "MISMATCH"
+	}
+
+	return fmt.Sprintf("%s source: %d documents, hash %s; target: %d documents, hash %s",
+		status, v.SourceCount, v.SourceHash, v.TargetCount, v.TargetHash)
+}
@@ -0,0 +1,131 @@
+package mongolang
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSyncHelpers(t *testing.T) {
+	doc := bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "a"}}
+
+	h1, h2 := sha256.New(), sha256.New()
+	hashDoc(h1, doc)
+	hashDoc(h2, bson.D{{Key: "name", Value: "a"}, {Key: "_id", Value: 1}})
+	if string(h1.Sum(nil)) == string(h2.Sum(nil)) {
+		t.Error("expected different hashes for documents with different field order")
+	}
+
+	model, ok := replaceModel(doc).(*mongo.ReplaceOneModel)
+	if !ok || model.Upsert == nil || !*model.Upsert || lookup(model.Filter.(bson.D), "_id") != 1 {
+		t.Errorf("unexpected replace model: %+v", model)
+	}
+
+	v := SyncVerification{SourceCount: 2, TargetCount: 1, SourceHash: "ab", TargetHash: "cd"}
+	if !strings.HasPrefix(v.String(), "MISMATCH source: 2 documents") {
+		t.Errorf("unexpected verification string: %s", v)
+	}
+
+	s := &Sync{CheckpointPath: filepath.Join(os.TempDir(), "no-such-checkpoint")}
+	if err := s.Reset(); err != nil {
+		t.Errorf("Reset() of missing checkpoint returned %v", err)
+	}
+}
+
+func TestSyncErr(t *testing.T) {
+	server, db := newFakeServer(t, map[string][]bson.D{"zips": testZips(1)})
+	defer server.close()
+	defer db.Disconnect()
+
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the stand-in server doesn't support change streams
+	// so Run() returns the error without changing DB.Err
+	earlier := errors.New("earlier error")
+	db.Err = earlier
+
+	s := db.Coll("zips").SyncTo(db.Coll("zipscopy"), filepath.Join(dir, "checkpoint"))
+	if err = s.Run(); err == nil || err == earlier {
+		t.Errorf("expected the change stream error, got %v", err)
+	}
+
+	if db.Err != earlier {
+		t.Errorf("expected DB.Err to be unchanged, got %v", db.Err)
+	}
+
+	if err = (&Sync{}).Run(); err != ErrInvalidColl {
+		t.Errorf("expected ErrInvalidColl, got %v", err)
+	}
+
+	// Verify doesn't change DB.Err either
+	v := s.Verify()
+	if v.Err != nil || v.SourceCount != 1 || v.TargetCount != 0 || v.Match || db.Err != earlier {
+		t.Errorf("unexpected verification %s, DB.Err %v", v, db.Err)
+	}
+
+	if v = (&Sync{}).Verify(); v.Err != ErrInvalidColl || v.String() != "ERROR "+ErrInvalidColl.Error() {
+		t.Errorf("expected ErrInvalidColl, got %s", v)
+	}
+
+	// the initial copy stops once Stop() is called
+	s.Stop()
+	if err = s.copyAll(); err != nil || s.Copied != 0 || server.commandCount("update") != 0 {
+		t.Errorf("expected the copy to stop, copied %d, error %v", s.Copied, err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	db := DB{}
+	db.InitMonGolang("mongodb://localhost:27017").Use("quickstart")
+	defer db.Disconnect()
+
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source, target := db.Coll("synctest"), db.Coll("synctestcopy")
+	source.DeleteMany(`{}`)
+	target.DeleteMany(`{}`)
+	source.InsertMany(`[{"_id":1,"x":1}, {"_id":2,"x":2}]`)
+
+	s := source.SyncTo(target, filepath.Join(dir, "checkpoint"))
+
+	done := make(chan error)
+	go func() { done <- s.Run() }()
+
+	time.Sleep(time.Second)
+	source.InsertOne(`{"_id":3,"x":3}`)
+	source.UpdateOne(`{"_id":1}`, `{"$set":{"x":10}}`)
+	source.DeleteOne(`{"_id":2}`)
+	time.Sleep(2 * time.Second)
+	s.Stop()
+
+	if err = <-done; err != nil {
+		t.Skipf("change streams not supported, possibly not a replica set: %v", err)
+	}
+
+	if s.Copied != 2 || s.Applied != 3 {
+		t.Errorf("TestSync copied %d and applied %d", s.Copied, s.Applied)
+	}
+
+	if v := s.Verify(); !v.Match || v.TargetCount != 2 {
+		t.Errorf("TestSync verify failed: %s", v)
+	}
+
+	source.DeleteMany(`{}`)
+	target.DeleteMany(`{}`)
+}
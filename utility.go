@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -20,6 +21,13 @@ func PrintStruct(s interface{}) {
 	fmt.Printf("%s\n", json)
 }
 
+// logf logs a message if a Logger has been set
+func logf(format string, a ...interface{}) {
+	if Logger != nil {
+		Logger.Printf(format, a...)
+	}
+}
+
 // Allowed Types Flags
 // Used to build a uint32 passed to verifyParm.
 // Example, to verify that parm is bson.D or bson.M:
@@ -43,16 +51,39 @@ const (
 //      bson.D slice or interface{} slice if one of those is allowed.
 //   3. If a string is passed, will assume it is an extended JSON string
 //      and call bson.UnmarshalExtJSON to parse the JSON string.
+//      If that fails, will parse it as MongoDB Shell syntax, see shellparse.go.
+//      If it can't be parsed, returns a *ParseError.
+//   4. If a *Pipeline is passed, will use its stages as a bson.D slice.
+//   5. If a *Query is passed, will use its filter as a bson.D.
 func verifyParm(parm interface{}, allowedTypes uint32) (interface{}, error) {
 
 	switch p := parm.(type) {
+	case *Pipeline:
+		if p.Err != nil {
+			return nil, p.Err
+		}
+
+		parm = p.Stages
+
+	case *Query:
+		if p.Err != nil {
+			return nil, p.Err
+		}
+
+		parm = p.Filter
+
 	case string: // parse strings
 		var result interface{}
 
 		err := bson.UnmarshalExtJSON([]byte(p), true, &result)
 
+		// not strict Extended JSON, try the MongoDB Shell syntax
+		if err != nil {
+			result, err = parseShellJSON(p)
+		}
+
 		if err != nil {
-			fmt.Printf("error in ParseJSONToBSON: %v \n", err)
+			logf("error parsing JSON: %v", err)
 			return nil, err
 		}
 
@@ -156,6 +187,51 @@ func verifyParm(parm interface{}, allowedTypes uint32) (interface{}, error) {
 	return nil, fmt.Errorf("invalid parm type: %T", parm)
 }
 
+// decodeTarget splits off an optional trailing parm which is a pointer
+// to a struct or map, typically a custom struct, that a result document
+// should be decoded into. Pointers which are parms themselves, such as
+// a *Query or *bson.M filter, are not decode targets.
+// Returns the remaining parms and the pointer, or nil if there wasn't one.
+func decodeTarget(parms []interface{}) ([]interface{}, interface{}) {
+	if len(parms) == 0 {
+		return parms, nil
+	}
+
+	last := parms[len(parms)-1]
+	switch last.(type) {
+	case nil, *Query, *Pipeline, *bson.D, *bson.M:
+		return parms, nil
+	}
+
+	t := reflect.TypeOf(last)
+	if t.Kind() != reflect.Ptr || (t.Elem().Kind() != reflect.Struct && t.Elem().Kind() != reflect.Map) {
+		return parms, nil
+	}
+
+	return parms[:len(parms)-1], last
+}
+
+// decodeDoc decodes a bson.D document into the variable v points to
+func decodeDoc(doc bson.D, v interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(raw, v)
+}
+
+// containsString returns true if s is in list
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 type printBSONParms struct {
 	indent      int
 	prevBracket bool
@@ -181,6 +181,37 @@ func TestVerifyParmsNil(t *testing.T) {
 	}
 }
 
+func TestDecodeTarget(t *testing.T) {
+	var r cityState
+
+	parms, target := decodeTarget([]interface{}{`{"upsert":true}`, &r})
+	if len(parms) != 1 || target != &r {
+		t.Errorf("decodeTarget did not split off pointer, parms: %v, target: %v", parms, target)
+	}
+
+	parms, target = decodeTarget([]interface{}{`{"upsert":true}`, nil})
+	if len(parms) != 2 || target != nil {
+		t.Errorf("decodeTarget split off nil parm, parms: %v, target: %v", parms, target)
+	}
+
+	for _, parm := range []interface{}{Q(), NewPipeline(), &bson.D{}, &bson.M{}, new(string)} {
+		parms, target = decodeTarget([]interface{}{parm})
+		if len(parms) != 1 || target != nil {
+			t.Errorf("decodeTarget split off %T parm, parms: %v, target: %v", parm, parms, target)
+		}
+	}
+
+	parms, target = decodeTarget(nil)
+	if len(parms) != 0 || target != nil {
+		t.Errorf("decodeTarget without parms returned parms: %v, target: %v", parms, target)
+	}
+
+	err := decodeDoc(bson.D{{Key: "state", Value: "CA"}, {Key: "city", Value: "BELL GARDENS"}}, &r)
+	if err != nil || r.State != "CA" || r.City != "BELL GARDENS" {
+		t.Errorf("decodeDoc returned %+v, error: %v", r, err)
+	}
+}
+
 func ExamplePrintBSON() {
 	pipeline := `[
         { "$match" : {"_id" : {"$oid":"5bf36072a5820f6e28a4736c"} }},